@@ -0,0 +1,91 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"talk-web/server/config"
+	"talk-web/server/model"
+	"talk-web/server/pkg/export"
+
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+)
+
+func main() {
+	os.Exit(run())
+}
+
+// run 执行导出并返回退出码，由 main 统一退出
+func run() int {
+	userID := flag.Uint("user", 0, "用户ID")
+	username := flag.String("username", "", "用户名（与 -user 二选一）")
+	conversationID := flag.Uint("conv", 0, "会话ID（可选，默认导出全部）")
+	format := flag.String("format", export.FormatMarkdown, "导出格式: json, markdown, zip")
+	output := flag.String("o", "", "输出文件（默认标准输出）")
+	audioDir := flag.String("audio-dir", "/tmp", "回复音频所在目录")
+	flag.Usage = func() {
+		fmt.Fprintln(os.Stderr, "用法: export -user <user_id> [-conv <conversation_id>] [-format json|markdown|zip] [-o 文件]")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if *userID == 0 && *username == "" {
+		flag.Usage()
+		return 1
+	}
+	if _, _, err := export.ContentType(*format); err != nil {
+		fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+		return 1
+	}
+
+	// 连接数据库（使用与服务端相同的环境变量）
+	cfg := config.Load()
+	db, err := gorm.Open(postgres.Open(cfg.DSN()), &gorm.Config{})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ 连接数据库失败: %v\n", err)
+		return 1
+	}
+
+	if *userID == 0 {
+		var user model.User
+		if err := db.Where("username = ?", *username).First(&user).Error; err != nil {
+			fmt.Fprintf(os.Stderr, "❌ 用户不存在: %s\n", *username)
+			return 1
+		}
+		*userID = user.ID
+	}
+
+	exporter := export.New(db, export.Options{
+		UserID:         *userID,
+		ConversationID: *conversationID,
+		AudioDir:       *audioDir,
+	})
+
+	if *output == "" {
+		if err := exporter.Write(os.Stdout, *format); err != nil {
+			fmt.Fprintf(os.Stderr, "❌ 导出失败: %v\n", err)
+			return 1
+		}
+		return 0
+	}
+
+	f, err := os.Create(*output)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ 创建输出文件失败: %v\n", err)
+		return 1
+	}
+	// 写入失败时删除不完整的文件；Close 的错误也要检查，缓冲的数据可能在这时才写入失败
+	err = exporter.Write(f, *format)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(*output)
+		fmt.Fprintf(os.Stderr, "❌ 导出失败: %v\n", err)
+		return 1
+	}
+
+	fmt.Printf("✅ 已导出到 %s\n", *output)
+	return 0
+}
@@ -3,44 +3,71 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"flag"
 	"fmt"
 	"os"
+	"talk-web/server/pkg/telegram"
 	"time"
 
 	"github.com/redis/go-redis/v9"
 )
 
-const (
-	InboxKey = "inbox:AlbertVoiceBot"
-)
-
-type Message struct {
-	Text      string `json:"text"`
-	Timestamp string `json:"timestamp"`
-}
-
 func main() {
-	if len(os.Args) < 2 {
-		fmt.Println("用法: reply <回复内容>")
-		fmt.Println("示例: reply \"你好，这是回复\"")
+	userID := flag.Uint("user", 0, "回复的用户ID")
+	replyTo := flag.String("msg", "", "被回复的消息ID")
+	conversationID := flag.Uint("conv", 0, "会话ID（可选）")
+	inbox := flag.String("inbox", telegram.DefaultUser, "收件箱名称")
+	redisAddr := flag.String("redis", "localhost:6379", "Redis 地址")
+	flag.Usage = func() {
+		fmt.Println("用法: reply -user <user_id> -msg <msg_id> <回复内容>")
+		fmt.Println("      reply \"to-web:<user_id>:<msg_id> <回复内容>\"  (旧格式)")
+		fmt.Println("示例: reply -user 1 -msg 1700000000-abc \"你好，这是回复\"")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if flag.NArg() < 1 {
+		flag.Usage()
 		os.Exit(1)
 	}
 
-	text := os.Args[1]
+	text := flag.Arg(0)
+
+	// 构建信封：优先使用参数，否则按旧格式解析
+	var env *telegram.Envelope
+	if *userID != 0 && *replyTo != "" {
+		env = &telegram.Envelope{
+			Kind:           telegram.KindToWeb,
+			UserID:         *userID,
+			ConversationID: *conversationID,
+			ReplyTo:        *replyTo,
+			Text:           text,
+		}
+	} else {
+		parsed, err := telegram.ParseEnvelope(&telegram.Message{Text: text})
+		if err != nil || parsed.Kind != telegram.KindToWeb {
+			fmt.Println("❌ 需要 -user 和 -msg 参数，或使用 to-web:<user_id>:<msg_id> 格式")
+			os.Exit(1)
+		}
+		env = parsed
+	}
+	env.Version = telegram.EnvelopeVersion
+	env.CreatedAt = time.Now()
 
 	// 连接 Redis
 	rdb := redis.NewClient(&redis.Options{
-		Addr: "localhost:6379",
+		Addr: *redisAddr,
 		DB:   0,
 	})
 	defer rdb.Close()
 
 	ctx := context.Background()
 
-	// 构建消息
-	msg := Message{
-		Text:      text,
-		Timestamp: time.Now().Format(time.RFC3339),
+	// 构建消息（Text 保留旧格式，兼容尚未迁移的监听方）
+	msg := telegram.Message{
+		Text:      env.LegacyText(),
+		Timestamp: env.CreatedAt.Format(time.RFC3339),
+		Envelope:  env,
 	}
 
 	msgJSON, err := json.Marshal(msg)
@@ -50,11 +77,12 @@ func main() {
 	}
 
 	// 推送到 Redis
-	err = rdb.LPush(ctx, InboxKey, msgJSON).Err()
+	inboxKey := telegram.InboxPrefix + *inbox
+	err = rdb.LPush(ctx, inboxKey, msgJSON).Err()
 	if err != nil {
 		fmt.Printf("❌ 推送到 Redis 失败: %v\n", err)
 		os.Exit(1)
 	}
 
-	fmt.Printf("✅ 已发送到 %s: %s\n", InboxKey, text)
+	fmt.Printf("✅ 已发送到 %s: %s\n", inboxKey, env.Text)
 }
@@ -3,18 +3,84 @@ package config
 import (
 	"fmt"
 	"os"
+	"strconv"
+	"time"
 )
 
 type Config struct {
-	DBHost      string
-	DBPort      string
-	DBUser      string
-	DBPassword  string
-	DBName      string
-	RedisAddr   string
-	JWTSecret   string
+	DBHost        string
+	DBPort        string
+	DBUser        string
+	DBPassword    string
+	DBName        string
+	RedisAddr     string
+	JWTSecret     string
 	TalkServerURL string
-	Port        string
+	Port          string
+
+	// 会话可以绑定的 bot（逗号分隔，默认 bot 总是允许）
+	TelegramBots string
+
+	// 令牌有效期
+	AccessTokenTTL  time.Duration
+	RefreshTokenTTL time.Duration
+
+	// 登录防爆破
+	LoginMaxFailures   int           // 同一用户名连续失败次数上限
+	LoginIPMaxFailures int           // 同一 IP 连续失败次数上限
+	LoginLockout       time.Duration // 锁定时长
+
+	// 密码策略
+	PasswordMinLength   int
+	PasswordMinClasses  int    // 小写、大写、数字、符号中至少包含几类
+	PasswordCheckCommon bool   // 拒绝常见密码
+	PasswordCommonFile  string // 额外的常见密码列表文件，每行一个
+
+	// 两步验证
+	TOTPIssuer string // 验证器 App 中显示的服务名称
+
+	// 密码重置
+	PublicURL        string        // 前端访问地址，用于拼接重置链接
+	PasswordResetTTL time.Duration // 重置链接有效期
+
+	// SMTP 邮件（SMTPHost 为空时不启用，只能把重置链接交给管理员转发）
+	SMTPHost     string
+	SMTPPort     int
+	SMTPUsername string
+	SMTPPassword string
+	SMTPFrom     string
+
+	// OpenID Connect 单点登录（OIDCIssuer 为空时不启用）
+	OIDCIssuer        string
+	OIDCClientID      string
+	OIDCClientSecret  string
+	OIDCRedirectURL   string // 如 https://talk.example.com/api/auth/oidc/callback
+	OIDCScopes        string // 空格分隔
+	OIDCGroupsClaim   string
+	OIDCAdminGroup    string // 属于该组的用户获得管理员角色
+	OIDCAutoProvision bool   // 首次登录时自动创建用户
+	OIDCTrustIdPMFA   bool   // 为 true 时信任身份提供方的多因素认证，不再要求本地两步验证
+
+	// 语音识别后端
+	STTBackend    string // exec、http 或 vosk
+	STTScriptPath string
+	STTModel      string
+	STTURL        string
+	STTAPIKey     string
+	STTLanguage   string
+	STTFFmpegPath string
+
+	// 语音合成后端
+	TTSBackend    string // exec 或 http
+	TTSScriptPath string
+	TTSScriptOpts bool // 脚本接受 --voice/--rate/--pitch/--format 选项
+	TTSURL        string
+	TTSStyle      string // openai 或 piper
+	TTSAPIKey     string
+	TTSModel      string
+	TTSVoice      string // 默认音色
+	TTSVoices     string // 用户可选的音色，逗号分隔，为空时使用后端内置列表
+	TTSFormat     string
 }
 
 func Load() *Config {
@@ -28,6 +94,60 @@ func Load() *Config {
 		JWTSecret:     getEnv("JWT_SECRET", "your-secret-key"),
 		TalkServerURL: getEnv("TALK_SERVER_URL", "http://localhost:5000"),
 		Port:          getEnv("PORT", "8080"),
+
+		TelegramBots: getEnv("TELEGRAM_BOTS", ""),
+
+		AccessTokenTTL:  getDuration("ACCESS_TOKEN_TTL", 15*time.Minute),
+		RefreshTokenTTL: getDuration("REFRESH_TOKEN_TTL", 30*24*time.Hour),
+
+		LoginMaxFailures:   getInt("LOGIN_MAX_FAILURES", 5),
+		LoginIPMaxFailures: getInt("LOGIN_IP_MAX_FAILURES", 20),
+		LoginLockout:       getDuration("LOGIN_LOCKOUT", 15*time.Minute),
+
+		PasswordMinLength:   getInt("PASSWORD_MIN_LENGTH", 8),
+		PasswordMinClasses:  getInt("PASSWORD_MIN_CLASSES", 2),
+		PasswordCheckCommon: getBool("PASSWORD_CHECK_COMMON", true),
+		PasswordCommonFile:  getEnv("PASSWORD_COMMON_FILE", ""),
+
+		TOTPIssuer: getEnv("TOTP_ISSUER", "Talk"),
+
+		PublicURL:        getEnv("PUBLIC_URL", "http://localhost:5173"),
+		PasswordResetTTL: getDuration("PASSWORD_RESET_TTL", 24*time.Hour),
+
+		SMTPHost:     getEnv("SMTP_HOST", ""),
+		SMTPPort:     getInt("SMTP_PORT", 587),
+		SMTPUsername: getEnv("SMTP_USERNAME", ""),
+		SMTPPassword: getEnv("SMTP_PASSWORD", ""),
+		SMTPFrom:     getEnv("SMTP_FROM", "Talk <noreply@localhost>"),
+
+		OIDCIssuer:        getEnv("OIDC_ISSUER", ""),
+		OIDCClientID:      getEnv("OIDC_CLIENT_ID", ""),
+		OIDCClientSecret:  getEnv("OIDC_CLIENT_SECRET", ""),
+		OIDCRedirectURL:   getEnv("OIDC_REDIRECT_URL", ""),
+		OIDCScopes:        getEnv("OIDC_SCOPES", "openid profile email groups"),
+		OIDCGroupsClaim:   getEnv("OIDC_GROUPS_CLAIM", "groups"),
+		OIDCAdminGroup:    getEnv("OIDC_ADMIN_GROUP", ""),
+		OIDCAutoProvision: getBool("OIDC_AUTO_PROVISION", true),
+		OIDCTrustIdPMFA:   getBool("OIDC_TRUST_IDP_MFA", false),
+
+		STTBackend:    getEnv("STT_BACKEND", "exec"),
+		STTScriptPath: getEnv("STT_SCRIPT_PATH", "/home/albert/.local/bin/stt"),
+		STTModel:      getEnv("STT_MODEL", ""),
+		STTURL:        getEnv("STT_URL", getEnv("TALK_SERVER_URL", "http://localhost:5000")),
+		STTAPIKey:     getEnv("STT_API_KEY", ""),
+		STTLanguage:   getEnv("STT_LANGUAGE", ""),
+		STTFFmpegPath: getEnv("STT_FFMPEG_PATH", "ffmpeg"),
+
+		TTSBackend:    getEnv("TTS_BACKEND", "exec"),
+		TTSScriptPath: getEnv("TTS_SCRIPT_PATH", "/home/albert/.local/bin/xiaoxiao-tts"),
+		TTSScriptOpts: getBool("TTS_SCRIPT_OPTIONS", false),
+		TTSURL:        getEnv("TTS_URL", ""),
+		TTSStyle:      getEnv("TTS_STYLE", "openai"),
+		TTSAPIKey:     getEnv("TTS_API_KEY", ""),
+		TTSModel:      getEnv("TTS_MODEL", ""),
+		TTSVoice:      getEnv("TTS_VOICE", ""),
+		TTSVoices:     getEnv("TTS_VOICES", ""),
+		TTSFormat:     getEnv("TTS_FORMAT", ""),
 	}
 }
 
@@ -42,3 +162,30 @@ func getEnv(key, defaultValue string) string {
 	}
 	return defaultValue
 }
+
+func getDuration(key string, defaultValue time.Duration) time.Duration {
+	if value := os.Getenv(key); value != "" {
+		if d, err := time.ParseDuration(value); err == nil {
+			return d
+		}
+	}
+	return defaultValue
+}
+
+func getInt(key string, defaultValue int) int {
+	if value := os.Getenv(key); value != "" {
+		if n, err := strconv.Atoi(value); err == nil {
+			return n
+		}
+	}
+	return defaultValue
+}
+
+func getBool(key string, defaultValue bool) bool {
+	if value := os.Getenv(key); value != "" {
+		if b, err := strconv.ParseBool(value); err == nil {
+			return b
+		}
+	}
+	return defaultValue
+}
@@ -3,28 +3,40 @@ package handler
 import (
 	"net/http"
 	"talk-web/server/model"
+	"talk-web/server/pkg/guard"
+	"talk-web/server/pkg/password"
+	"talk-web/server/pkg/ws"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
 )
 
 type AdminHandler struct {
-	db *gorm.DB
+	db     *gorm.DB
+	hub    *ws.Hub
+	guard  *guard.LoginGuard
+	policy *password.Policy
 }
 
-func NewAdminHandler(db *gorm.DB) *AdminHandler {
-	return &AdminHandler{db: db}
+func NewAdminHandler(db *gorm.DB, hub *ws.Hub, loginGuard *guard.LoginGuard, policy *password.Policy) *AdminHandler {
+	return &AdminHandler{db: db, hub: hub, guard: loginGuard, policy: policy}
 }
 
 type CreateUserRequest struct {
 	Username string `json:"username" binding:"required"`
 	Password string `json:"password" binding:"required"`
-	IsAdmin  bool   `json:"is_admin"`
+	Role     string `json:"role"`     // 为空时按 is_admin 决定
+	IsAdmin  bool   `json:"is_admin"` // 兼容旧客户端
 }
 
 type UpdateUserRequest struct {
 	Password *string `json:"password,omitempty"`
-	IsAdmin  *bool   `json:"is_admin,omitempty"`
+	IsAdmin  *bool   `json:"is_admin,omitempty"` // 兼容旧客户端，新客户端使用 SetRole
+}
+
+type SetRoleRequest struct {
+	Role string `json:"role" binding:"required"`
 }
 
 func (h *AdminHandler) ListUsers(c *gin.Context) {
@@ -44,9 +56,28 @@ func (h *AdminHandler) CreateUser(c *gin.Context) {
 		return
 	}
 
+	if err := h.policy.Validate(req.Password, req.Username); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	role := req.Role
+	if role == "" {
+		role = model.RoleUser
+		if req.IsAdmin {
+			role = model.RoleAdmin
+		}
+	}
+	if !model.ValidRole(role) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "未知的角色: " + role})
+		return
+	}
+
+	// 管理员设置的初始密码，用户首次登录后必须修改
 	user := model.User{
-		Username: req.Username,
-		IsAdmin:  req.IsAdmin,
+		Username:           req.Username,
+		Role:               role,
+		MustChangePassword: true,
 	}
 
 	if err := user.SetPassword(req.Password); err != nil {
@@ -59,6 +90,8 @@ func (h *AdminHandler) CreateUser(c *gin.Context) {
 		return
 	}
 
+	recordAuditChange(h.db, c, "user.created", guard.UserKey(user.Username), nil, userSnapshot(&user), nil)
+
 	c.JSON(http.StatusCreated, user)
 }
 
@@ -77,32 +110,238 @@ func (h *AdminHandler) UpdateUser(c *gin.Context) {
 		return
 	}
 
+	// 改密码或降权后，该用户现有的令牌全部失效
+	invalidate := false
+	before := userSnapshot(&user)
+
 	if req.Password != nil {
+		if err := h.policy.Validate(*req.Password, user.Username); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
 		if err := user.SetPassword(*req.Password); err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "密码加密失败"})
 			return
 		}
+		user.MustChangePassword = true
+		invalidate = true
 	}
 
 	if req.IsAdmin != nil {
-		user.IsAdmin = *req.IsAdmin
+		role := model.RoleUser
+		if *req.IsAdmin {
+			role = model.RoleAdmin
+		}
+		if user.ID == c.GetUint("user_id") && role != user.Role {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "不能修改自己的角色"})
+			return
+		}
+		if model.RoleRank(role) < model.RoleRank(user.Role) {
+			invalidate = true
+		}
+		user.Role = role
 	}
 
-	if err := h.db.Save(&user).Error; err != nil {
+	err := h.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&user).Select("password", "must_change_password", "role", "is_admin").Updates(&user).Error; err != nil {
+			return err
+		}
+		if invalidate {
+			return revokeCredentials(tx, user.ID, 0)
+		}
+		return nil
+	})
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "更新用户失败"})
 		return
 	}
+	if invalidate {
+		disconnectSessions(h.hub, user.ID, 0, "credentials_changed")
+	}
+
+	recordAuditChange(h.db, c, "user.updated", guard.UserKey(user.Username), before, userSnapshot(&user), nil)
 
 	c.JSON(http.StatusOK, user)
 }
 
 func (h *AdminHandler) DeleteUser(c *gin.Context) {
-	id := c.Param("id")
+	var user model.User
+	if err := h.db.First(&user, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "用户不存在"})
+		return
+	}
 
-	if err := h.db.Delete(&model.User{}, id).Error; err != nil {
+	err := h.db.Transaction(func(tx *gorm.DB) error {
+		if err := revokeCredentials(tx, user.ID, 0); err != nil {
+			return err
+		}
+		return tx.Delete(&user).Error
+	})
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "删除用户失败"})
 		return
 	}
+	disconnectSessions(h.hub, user.ID, 0, "user_deleted")
+
+	recordAuditChange(h.db, c, "user.deleted", guard.UserKey(user.Username), userSnapshot(&user), nil, nil)
 
 	c.JSON(http.StatusOK, gin.H{"message": "删除成功"})
 }
+
+// ListRoles 列出所有角色及其权限
+func (h *AdminHandler) ListRoles(c *gin.Context) {
+	roles := make([]gin.H, 0, len(model.Roles))
+	for _, role := range model.Roles {
+		roles = append(roles, gin.H{
+			"role":        role,
+			"permissions": model.RolePermissions(role),
+		})
+	}
+	c.JSON(http.StatusOK, roles)
+}
+
+// SetRole 修改用户角色，降级后该用户现有的令牌全部失效
+func (h *AdminHandler) SetRole(c *gin.Context) {
+	var user model.User
+	if err := h.db.First(&user, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "用户不存在"})
+		return
+	}
+
+	var req SetRoleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请求参数错误"})
+		return
+	}
+	if !model.ValidRole(req.Role) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "未知的角色: " + req.Role})
+		return
+	}
+	// 避免管理员误操作把自己降级后无人能管理
+	if user.ID == c.GetUint("user_id") {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "不能修改自己的角色"})
+		return
+	}
+
+	before := userSnapshot(&user)
+	oldRole := user.Role
+	if oldRole == req.Role {
+		c.JSON(http.StatusOK, user)
+		return
+	}
+
+	user.Role = req.Role
+	demoted := model.RoleRank(req.Role) < model.RoleRank(oldRole)
+	err := h.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&user).Select("role", "is_admin").Updates(&user).Error; err != nil {
+			return err
+		}
+		if demoted {
+			return revokeCredentials(tx, user.ID, 0)
+		}
+		return nil
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "修改角色失败"})
+		return
+	}
+	if demoted {
+		disconnectSessions(h.hub, user.ID, 0, "role_changed")
+	}
+
+	recordAuditChange(h.db, c, "user.role_changed", guard.UserKey(user.Username), before, userSnapshot(&user), nil)
+	c.JSON(http.StatusOK, user)
+}
+
+type BroadcastRequest struct {
+	Text string `json:"text" binding:"required"`
+}
+
+// Broadcast 向所有在线用户广播一条通知（不持久化，离线用户收不到）
+func (h *AdminHandler) Broadcast(c *gin.Context) {
+	var req BroadcastRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请求参数错误"})
+		return
+	}
+
+	h.hub.BroadcastToAll("broadcast", map[string]interface{}{
+		"text":      req.Text,
+		"from":      c.GetString("username"),
+		"timestamp": time.Now().Unix(),
+	})
+
+	recordAudit(h.db, c, "broadcast.sent", "", "", gin.H{"text": req.Text})
+	c.JSON(http.StatusOK, gin.H{"message": "广播已发送"})
+}
+
+// ResetTwoFactor 重置用户的两步验证（用户丢失验证器和恢复码时使用）
+func (h *AdminHandler) ResetTwoFactor(c *gin.Context) {
+	var user model.User
+	if err := h.db.First(&user, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "用户不存在"})
+		return
+	}
+
+	// 重置通常意味着验证器丢失或泄露，已登录的设备也要重新认证
+	err := h.db.Transaction(func(tx *gorm.DB) error {
+		if err := resetTwoFactor(tx, user.ID); err != nil {
+			return err
+		}
+		return revokeCredentials(tx, user.ID, 0)
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "重置两步验证失败"})
+		return
+	}
+	disconnectSessions(h.hub, user.ID, 0, "2fa_reset")
+
+	recordAudit(h.db, c, "2fa.reset", guard.UserKey(user.Username), "", gin.H{"was_enabled": user.TOTPEnabled})
+
+	c.JSON(http.StatusOK, gin.H{"message": "已重置两步验证"})
+}
+
+// ListLockouts 列出登录失败记录（包括已锁定和正在退避的用户名/IP）
+func (h *AdminHandler) ListLockouts(c *gin.Context) {
+	states, err := h.guard.List()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "查询锁定列表失败"})
+		return
+	}
+
+	now := time.Now()
+	items := make([]gin.H, 0, len(states))
+	for _, state := range states {
+		items = append(items, gin.H{
+			"key":          state.Key,
+			"failures":     state.Failures,
+			"last_failure": state.LastFailure,
+			"locked_until": state.LockedUntil,
+			"locked":       now.Before(state.LockedUntil),
+		})
+	}
+
+	c.JSON(http.StatusOK, items)
+}
+
+// ClearLockout 解除锁定，kind 为 user 或 ip
+func (h *AdminHandler) ClearLockout(c *gin.Context) {
+	var key string
+	switch c.Param("kind") {
+	case "user":
+		key = guard.UserKey(c.Param("value"))
+	case "ip":
+		key = guard.IPKey(c.Param("value"))
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "类型只能是 user 或 ip"})
+		return
+	}
+
+	if err := h.guard.Clear(key); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "解除锁定失败"})
+		return
+	}
+
+	recordAudit(h.db, c, "lockout.cleared", key, "", nil)
+	c.JSON(http.StatusOK, gin.H{"message": "已解除锁定"})
+}
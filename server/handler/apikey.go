@@ -0,0 +1,153 @@
+package handler
+
+import (
+	"net/http"
+	"talk-web/server/middleware"
+	"talk-web/server/model"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// maxAPIKeysPerUser 每个用户最多同时拥有的有效 API key 数量
+const maxAPIKeysPerUser = 20
+
+type APIKeyHandler struct {
+	db *gorm.DB
+}
+
+func NewAPIKeyHandler(db *gorm.DB) *APIKeyHandler {
+	return &APIKeyHandler{db: db}
+}
+
+type CreateAPIKeyRequest struct {
+	Name      string     `json:"name" binding:"required"`
+	Scopes    []string   `json:"scopes"`     // 默认 read + write
+	ExpiresAt *time.Time `json:"expires_at"` // 为空表示永不过期
+}
+
+type CreateAPIKeyResponse struct {
+	model.APIKey
+	Key string `json:"key"` // 明文只返回这一次
+}
+
+// ListAPIKeys 列出当前用户未撤销的 API key
+func (h *APIKeyHandler) ListAPIKeys(c *gin.Context) {
+	userID := c.GetUint("user_id")
+
+	var keys []model.APIKey
+	if err := h.db.Where("user_id = ? AND revoked_at IS NULL", userID).
+		Order("created_at desc").
+		Find(&keys).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "查询 API key 失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, keys)
+}
+
+// CreateAPIKey 创建 API key
+func (h *APIKeyHandler) CreateAPIKey(c *gin.Context) {
+	userID := c.GetUint("user_id")
+
+	var req CreateAPIKeyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请求参数错误"})
+		return
+	}
+
+	scopes, ok := h.normalizeScopes(c, req.Scopes)
+	if !ok {
+		return
+	}
+	if req.ExpiresAt != nil && !req.ExpiresAt.After(time.Now()) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "过期时间必须晚于当前时间"})
+		return
+	}
+
+	var count int64
+	h.db.Model(&model.APIKey{}).
+		Where("user_id = ? AND revoked_at IS NULL AND (expires_at IS NULL OR expires_at > ?)", userID, time.Now()).
+		Count(&count)
+	if count >= maxAPIKeysPerUser {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "API key 数量已达上限"})
+		return
+	}
+
+	key, hash, prefix, err := middleware.NewAPIKey()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "生成 API key 失败"})
+		return
+	}
+
+	apiKey := model.APIKey{
+		UserID:    userID,
+		Name:      req.Name,
+		Prefix:    prefix,
+		KeyHash:   hash,
+		Scopes:    scopes,
+		ExpiresAt: req.ExpiresAt,
+	}
+	if err := h.db.Create(&apiKey).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "创建 API key 失败"})
+		return
+	}
+
+	recordAudit(h.db, c, "api_key.created", "api_key:"+prefix, "", gin.H{"name": req.Name, "scopes": scopes})
+	c.JSON(http.StatusCreated, CreateAPIKeyResponse{APIKey: apiKey, Key: key})
+}
+
+// RevokeAPIKey 撤销当前用户的某个 API key
+func (h *APIKeyHandler) RevokeAPIKey(c *gin.Context) {
+	userID := c.GetUint("user_id")
+
+	var apiKey model.APIKey
+	if err := h.db.Where("id = ? AND user_id = ? AND revoked_at IS NULL", c.Param("id"), userID).
+		First(&apiKey).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "API key 不存在"})
+		return
+	}
+
+	if err := h.db.Model(&apiKey).Update("revoked_at", time.Now()).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "撤销 API key 失败"})
+		return
+	}
+
+	recordAudit(h.db, c, "api_key.revoked", "api_key:"+apiKey.Prefix, "", gin.H{"name": apiKey.Name})
+	c.JSON(http.StatusOK, gin.H{"message": "API key 已撤销"})
+}
+
+// normalizeScopes 校验并去重权限范围，只能授予自己角色拥有的权限
+func (h *APIKeyHandler) normalizeScopes(c *gin.Context, requested []string) ([]string, bool) {
+	if len(requested) == 0 {
+		return []string{model.ScopeRead, model.ScopeWrite}, true
+	}
+
+	seen := make(map[string]bool)
+	scopes := make([]string, 0, len(requested))
+	for _, scope := range requested {
+		switch scope {
+		case model.ScopeRead, model.ScopeWrite:
+		case model.ScopeAdmin:
+			if c.GetString("role") == model.RoleUser {
+				c.JSON(http.StatusForbidden, gin.H{"error": "普通用户不能创建 admin 权限的 API key"})
+				return nil, false
+			}
+		default:
+			if !model.ValidPermission(scope) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "未知的权限范围: " + scope})
+				return nil, false
+			}
+			if !middleware.HasPermission(c, scope) {
+				c.JSON(http.StatusForbidden, gin.H{"error": "不能授予自己没有的权限: " + scope})
+				return nil, false
+			}
+		}
+		if !seen[scope] {
+			seen[scope] = true
+			scopes = append(scopes, scope)
+		}
+	}
+	return scopes, true
+}
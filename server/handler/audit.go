@@ -0,0 +1,249 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"talk-web/server/model"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const (
+	defaultAuditLimit = 50
+	maxAuditLimit     = 200
+)
+
+// redactedFields 变更记录中只标记“已修改”、不保存取值的字段
+var redactedFields = map[string]bool{
+	"password":     true,
+	"refresh_hash": true,
+	"key_hash":     true,
+}
+
+const redacted = "[REDACTED]"
+
+// AuditEventItem 审计记录查询结果，changes 和 detail 以 JSON 对象返回
+type AuditEventItem struct {
+	model.AuditEvent
+	Changes json.RawMessage `json:"changes"`
+	Detail  json.RawMessage `json:"detail"`
+}
+
+// auditChange 单个字段的变更
+type auditChange struct {
+	From interface{} `json:"from"`
+	To   interface{} `json:"to"`
+}
+
+// userSnapshot 用户的可审计字段，password 为哈希，写入前会被脱敏
+func userSnapshot(u *model.User) map[string]interface{} {
+	if u == nil {
+		return nil
+	}
+	return map[string]interface{}{
+		"username":             u.Username,
+		"password":             u.Password,
+		"role":                 u.Role,
+		"must_change_password": u.MustChangePassword,
+		"pending_approval":     u.PendingApproval,
+		"tts_voice":            u.TTSVoice,
+		"tts_rate":             u.TTSRate,
+		"tts_pitch":            u.TTSPitch,
+	}
+}
+
+// auditDiff 对比两个快照，返回变化的字段；before 或 after 为 nil 表示创建或删除
+func auditDiff(before, after map[string]interface{}) map[string]auditChange {
+	changes := make(map[string]auditChange)
+	for key, to := range after {
+		from, ok := before[key]
+		if ok && reflect.DeepEqual(from, to) {
+			continue
+		}
+		if !ok {
+			from = nil
+		}
+		changes[key] = redactChange(key, from, to)
+	}
+	for key, from := range before {
+		if _, ok := after[key]; !ok {
+			changes[key] = redactChange(key, from, nil)
+		}
+	}
+	return changes
+}
+
+func redactChange(key string, from, to interface{}) auditChange {
+	if redactedFields[key] {
+		if from != nil {
+			from = redacted
+		}
+		if to != nil {
+			to = redacted
+		}
+	}
+	return auditChange{From: from, To: to}
+}
+
+// recordAudit 写入一条审计记录，失败只打印日志，不影响请求本身
+// 已登录的请求从上下文中取操作人，否则使用 actorName
+func recordAudit(db *gorm.DB, c *gin.Context, action, target, actorName string, detail interface{}) {
+	writeAudit(db, c, action, target, actorName, nil, detail)
+}
+
+// recordAuditChange 写入带字段变更的审计记录
+func recordAuditChange(db *gorm.DB, c *gin.Context, action, target string, before, after map[string]interface{}, detail interface{}) {
+	writeAudit(db, c, action, target, "", auditDiff(before, after), detail)
+}
+
+func writeAudit(db *gorm.DB, c *gin.Context, action, target, actorName string, changes map[string]auditChange, detail interface{}) {
+	event := model.AuditEvent{
+		ActorName: actorName,
+		Action:    action,
+		Target:    target,
+		Changes:   "{}",
+		Detail:    "{}",
+		IP:        c.ClientIP(),
+		UserAgent: c.Request.UserAgent(),
+	}
+	if userID := c.GetUint("user_id"); userID != 0 {
+		event.ActorID = &userID
+		event.ActorName = c.GetString("username")
+	}
+	if len(changes) > 0 {
+		if data, err := json.Marshal(changes); err == nil {
+			event.Changes = string(data)
+		}
+	}
+	if detail != nil {
+		if data, err := json.Marshal(detail); err == nil {
+			event.Detail = string(data)
+		}
+	}
+
+	if err := db.Create(&event).Error; err != nil {
+		fmt.Printf("[Audit Error] action=%s target=%s: %v\n", action, target, err)
+	}
+}
+
+// ListAuditEvents 查询审计记录（按时间倒序，游标分页）
+//
+// 查询参数：
+//   - limit: 每页条数（默认 50，最大 200）
+//   - cursor: 上一页返回的 next_cursor
+//   - actor_id, actor: 操作人 ID 或用户名
+//   - action: 操作类型，以 .* 结尾时按前缀匹配（如 login.*）
+//   - target: 操作对象（如 user:alice）
+//   - ip: 来源 IP
+//   - from, to: 时间范围（RFC3339 或 2006-01-02，to 为日期时包含当天）
+func (h *AdminHandler) ListAuditEvents(c *gin.Context) {
+	limit := defaultAuditLimit
+	if v := c.Query("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "limit 参数无效"})
+			return
+		}
+		if n > maxAuditLimit {
+			n = maxAuditLimit
+		}
+		limit = n
+	}
+
+	query := h.db.Model(&model.AuditEvent{})
+
+	if v := c.Query("cursor"); v != "" {
+		cursor, err := strconv.ParseUint(v, 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "cursor 参数无效"})
+			return
+		}
+		query = query.Where("id < ?", cursor)
+	}
+	if v := c.Query("actor_id"); v != "" {
+		actorID, err := strconv.ParseUint(v, 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "actor_id 参数无效"})
+			return
+		}
+		query = query.Where("actor_id = ?", actorID)
+	}
+	if v := c.Query("actor"); v != "" {
+		query = query.Where("actor_name = ?", v)
+	}
+	if v := c.Query("action"); v != "" {
+		if prefix, ok := strings.CutSuffix(v, "*"); ok {
+			query = query.Where("action LIKE ?", escapeLike(prefix)+"%")
+		} else {
+			query = query.Where("action = ?", v)
+		}
+	}
+	if v := c.Query("target"); v != "" {
+		query = query.Where("target = ?", v)
+	}
+	if v := c.Query("ip"); v != "" {
+		query = query.Where("ip = ?", v)
+	}
+	if v := c.Query("from"); v != "" {
+		from, _, err := parseTimeParam(v)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "from 参数无效"})
+			return
+		}
+		query = query.Where("created_at >= ?", from)
+	}
+	if v := c.Query("to"); v != "" {
+		to, dateOnly, err := parseTimeParam(v)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "to 参数无效"})
+			return
+		}
+		if dateOnly {
+			to = to.AddDate(0, 0, 1)
+		}
+		query = query.Where("created_at < ?", to)
+	}
+
+	// 多取一条用于判断是否还有下一页
+	var events []model.AuditEvent
+	if err := query.Order("id desc").Limit(limit + 1).Find(&events).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "查询审计记录失败"})
+		return
+	}
+
+	hasMore := len(events) > limit
+	if hasMore {
+		events = events[:limit]
+	}
+
+	items := make([]AuditEventItem, 0, len(events))
+	for _, e := range events {
+		items = append(items, AuditEventItem{
+			AuditEvent: e,
+			Changes:    rawJSON(e.Changes),
+			Detail:     rawJSON(e.Detail),
+		})
+	}
+
+	resp := gin.H{
+		"events":   items,
+		"count":    len(items),
+		"has_more": hasMore,
+	}
+	if hasMore {
+		resp["next_cursor"] = strconv.FormatUint(uint64(events[len(events)-1].ID), 10)
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+func rawJSON(s string) json.RawMessage {
+	if s == "" {
+		return json.RawMessage("{}")
+	}
+	return json.RawMessage(s)
+}
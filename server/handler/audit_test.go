@@ -0,0 +1,78 @@
+package handler
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestAuditDiff(t *testing.T) {
+	tests := []struct {
+		name   string
+		before map[string]interface{}
+		after  map[string]interface{}
+		want   map[string]auditChange
+	}{
+		{
+			name:   "no changes",
+			before: map[string]interface{}{"role": "user", "tts_rate": 1.0},
+			after:  map[string]interface{}{"role": "user", "tts_rate": 1.0},
+			want:   map[string]auditChange{},
+		},
+		{
+			name:   "changed field",
+			before: map[string]interface{}{"role": "user", "username": "alice"},
+			after:  map[string]interface{}{"role": "admin", "username": "alice"},
+			want:   map[string]auditChange{"role": {From: "user", To: "admin"}},
+		},
+		{
+			name:   "created",
+			before: nil,
+			after:  map[string]interface{}{"username": "alice"},
+			want:   map[string]auditChange{"username": {From: nil, To: "alice"}},
+		},
+		{
+			name:   "deleted",
+			before: map[string]interface{}{"username": "alice"},
+			after:  nil,
+			want:   map[string]auditChange{"username": {From: "alice", To: nil}},
+		},
+		{
+			name:   "added and removed keys",
+			before: map[string]interface{}{"old": 1},
+			after:  map[string]interface{}{"new": 2},
+			want:   map[string]auditChange{"old": {From: 1, To: nil}, "new": {From: nil, To: 2}},
+		},
+		{
+			name:   "redacts changed secret",
+			before: map[string]interface{}{"password": "$2a$10$old"},
+			after:  map[string]interface{}{"password": "$2a$10$new"},
+			want:   map[string]auditChange{"password": {From: redacted, To: redacted}},
+		},
+		{
+			name:   "redacts created secret",
+			before: nil,
+			after:  map[string]interface{}{"key_hash": "abc"},
+			want:   map[string]auditChange{"key_hash": {From: nil, To: redacted}},
+		},
+		{
+			name:   "unchanged secret omitted",
+			before: map[string]interface{}{"password": "$2a$10$same"},
+			after:  map[string]interface{}{"password": "$2a$10$same"},
+			want:   map[string]auditChange{},
+		},
+		{
+			name:   "different types are a change",
+			before: map[string]interface{}{"tts_rate": 1},
+			after:  map[string]interface{}{"tts_rate": 1.0},
+			want:   map[string]auditChange{"tts_rate": {From: 1, To: 1.0}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := auditDiff(tt.before, tt.after); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("auditDiff() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
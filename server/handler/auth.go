@@ -1,30 +1,49 @@
 package handler
 
 import (
+	"fmt"
+	"math"
 	"net/http"
+	"strconv"
 	"talk-web/server/middleware"
 	"talk-web/server/model"
+	"talk-web/server/pkg/guard"
+	"talk-web/server/pkg/password"
+	"talk-web/server/pkg/tts"
+	"talk-web/server/pkg/ws"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
 )
 
 type AuthHandler struct {
-	db *gorm.DB
+	db         *gorm.DB
+	refreshTTL time.Duration
+	guard      *guard.LoginGuard
+	policy     *password.Policy
+	totpIssuer string // 验证器 App 中显示的服务名称
+	hub        *ws.Hub
+	voices     map[string]bool // 语音合成后端支持的音色
 }
 
-func NewAuthHandler(db *gorm.DB) *AuthHandler {
-	return &AuthHandler{db: db}
+func NewAuthHandler(db *gorm.DB, hub *ws.Hub, refreshTTL time.Duration, loginGuard *guard.LoginGuard, policy *password.Policy, totpIssuer string, voices []string) *AuthHandler {
+	allowed := make(map[string]bool, len(voices))
+	for _, voice := range voices {
+		allowed[voice] = true
+	}
+	return &AuthHandler{db: db, hub: hub, refreshTTL: refreshTTL, guard: loginGuard, policy: policy, totpIssuer: totpIssuer, voices: allowed}
 }
 
 type LoginRequest struct {
 	Username string `json:"username" binding:"required"`
 	Password string `json:"password" binding:"required"`
+	Device   string `json:"device"` // 可选的设备名称，显示在会话列表中
 }
 
 type LoginResponse struct {
-	Token string      `json:"token"`
-	User  *model.User `json:"user"`
+	TokenPair
+	User *model.User `json:"user"`
 }
 
 func (h *AuthHandler) Login(c *gin.Context) {
@@ -34,34 +53,194 @@ func (h *AuthHandler) Login(c *gin.Context) {
 		return
 	}
 
+	if !h.checkGuard(c, req.Username) {
+		return
+	}
+
 	var user model.User
 	if err := h.db.Where("username = ?", req.Username).First(&user).Error; err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "用户名或密码错误"})
+		model.CheckDummyPassword(req.Password)
+		h.loginFailed(c, req.Username, "unknown_user")
 		return
 	}
 
 	if !user.CheckPassword(req.Password) {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "用户名或密码错误"})
+		h.loginFailed(c, req.Username, "wrong_password")
+		return
+	}
+
+	// 密码正确后才提示待审核，避免泄露账号状态
+	if user.PendingApproval {
+		c.JSON(http.StatusForbidden, gin.H{"error": errPendingApproval.Error(), "code": "pending_approval"})
 		return
 	}
 
-	token, err := middleware.GenerateToken(user.ID, user.Username, user.IsAdmin)
+	// 开启了两步验证：密码正确后只返回挑战令牌，验证码通过后才签发会话
+	if user.TOTPEnabled {
+		h.issueChallenge(c, &user, req.Device)
+		return
+	}
+
+	h.completeLogin(c, &user, req.Device, "password")
+}
+
+// checkGuard 检查登录限流，被限制时已写入响应
+func (h *AuthHandler) checkGuard(c *gin.Context, username string) bool {
+	wait, err := h.guard.Check(username, c.ClientIP())
+	if err != nil {
+		// 限流存储不可用时不阻止登录
+		fmt.Printf("[Login Guard Error] %v\n", err)
+	}
+	if wait > 0 {
+		recordAudit(h.db, c, "login.blocked", guard.UserKey(username), username, gin.H{"retry_after": retrySeconds(wait)})
+		c.Header("Retry-After", strconv.Itoa(retrySeconds(wait)))
+		c.JSON(http.StatusTooManyRequests, gin.H{
+			"error":       fmt.Sprintf("尝试次数过多，请 %d 秒后再试", retrySeconds(wait)),
+			"retry_after": retrySeconds(wait),
+		})
+		return false
+	}
+	return true
+}
+
+// completeLogin 认证全部通过后清除失败记录、签发会话并返回令牌
+func (h *AuthHandler) completeLogin(c *gin.Context, user *model.User, device, method string) {
+	if err := h.guard.Succeed(user.Username); err != nil {
+		fmt.Printf("[Login Guard Error] %v\n", err)
+	}
+
+	tokens, err := issueSession(h.db, c, user, device, h.refreshTTL)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "生成token失败"})
 		return
 	}
 
+	// 登录请求没有经过 AuthRequired，审计记录的操作人需要手动设置
+	c.Set("user_id", user.ID)
+	c.Set("username", user.Username)
+	recordAudit(h.db, c, "login.succeeded", guard.UserKey(user.Username), "", gin.H{"device": device, "method": method})
+
 	c.JSON(http.StatusOK, LoginResponse{
-		Token: token,
-		User:  &user,
+		TokenPair: *tokens,
+		User:      user,
 	})
 }
 
+// loginFailed 记录一次登录失败并返回统一的错误信息
+func (h *AuthHandler) loginFailed(c *gin.Context, username, reason string) {
+	locked, err := h.guard.Fail(username, c.ClientIP())
+	if err != nil {
+		fmt.Printf("[Login Guard Error] %v\n", err)
+	}
+
+	detail := gin.H{"reason": reason}
+	if locked {
+		detail["locked"] = true
+	}
+	recordAudit(h.db, c, "login.failed", guard.UserKey(username), username, detail)
+
+	c.JSON(http.StatusUnauthorized, gin.H{"error": "用户名或密码错误"})
+}
+
+func retrySeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
+
+// Logout 撤销当前会话，访问令牌和 refresh token 立即失效
 func (h *AuthHandler) Logout(c *gin.Context) {
-	// 客户端删除token即可
+	sessionID := c.GetUint("session_id")
+
+	if err := h.db.Model(&model.Session{}).
+		Where("id = ? AND revoked_at IS NULL", sessionID).
+		Update("revoked_at", time.Now()).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "登出失败"})
+		return
+	}
+	// 该会话建立的 WebSocket / SSE 连接一并断开
+	if sessionID != 0 {
+		h.hub.DisconnectSession(c.GetUint("user_id"), sessionID, "logout")
+	}
+
+	recordAudit(h.db, c, "logout", fmt.Sprintf("session:%d", sessionID), "", nil)
 	c.JSON(http.StatusOK, gin.H{"message": "登出成功"})
 }
 
+type ChangePasswordRequest struct {
+	OldPassword string `json:"old_password" binding:"required"`
+	NewPassword string `json:"new_password" binding:"required"`
+}
+
+// ChangePassword 修改自己的密码，其他会话、令牌和推送连接全部失效
+// 当前会话保留，返回为它重新签发的访问令牌
+func (h *AuthHandler) ChangePassword(c *gin.Context) {
+	userID := c.GetUint("user_id")
+
+	var req ChangePasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请求参数错误"})
+		return
+	}
+
+	var user model.User
+	if err := h.db.First(&user, userID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "用户不存在"})
+		return
+	}
+
+	if !user.CheckPassword(req.OldPassword) {
+		recordAudit(h.db, c, "password.change_failed", guard.UserKey(user.Username), "", gin.H{"reason": "wrong_password"})
+		c.JSON(http.StatusBadRequest, gin.H{"error": "原密码错误"})
+		return
+	}
+	if req.NewPassword == req.OldPassword {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "新密码不能与原密码相同"})
+		return
+	}
+	if err := h.policy.Validate(req.NewPassword, user.Username); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	before := userSnapshot(&user)
+	if err := user.SetPassword(req.NewPassword); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "密码加密失败"})
+		return
+	}
+	user.MustChangePassword = false
+
+	// 其他设备需要用新密码重新登录
+	sessionID := c.GetUint("session_id")
+	err := h.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&user).Select("password", "must_change_password").Updates(&user).Error; err != nil {
+			return err
+		}
+		return revokeCredentials(tx, user.ID, sessionID)
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "修改密码失败"})
+		return
+	}
+	disconnectSessions(h.hub, user.ID, sessionID, "password_changed")
+
+	// 令牌版本已递增，重新读取后为当前会话签发新令牌
+	if err := h.db.First(&user, user.ID).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "生成token失败"})
+		return
+	}
+	token, err := middleware.GenerateToken(&user, sessionID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "生成token失败"})
+		return
+	}
+
+	recordAuditChange(h.db, c, "password.changed", guard.UserKey(user.Username), before, userSnapshot(&user), nil)
+	c.JSON(http.StatusOK, gin.H{
+		"token":      token,
+		"expires_in": int(middleware.AccessTokenTTL().Seconds()),
+		"user":       user,
+	})
+}
+
 func (h *AuthHandler) Me(c *gin.Context) {
 	userID := c.GetUint("user_id")
 
@@ -73,3 +252,60 @@ func (h *AuthHandler) Me(c *gin.Context) {
 
 	c.JSON(http.StatusOK, user)
 }
+
+type UpdatePreferencesRequest struct {
+	TTSVoice *string  `json:"tts_voice,omitempty"`
+	TTSRate  *float64 `json:"tts_rate,omitempty"`
+	TTSPitch *string  `json:"tts_pitch,omitempty"`
+}
+
+// UpdatePreferences 更新当前用户的语音偏好
+func (h *AuthHandler) UpdatePreferences(c *gin.Context) {
+	userID := c.GetUint("user_id")
+
+	var user model.User
+	if err := h.db.First(&user, userID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "用户不存在"})
+		return
+	}
+
+	var req UpdatePreferencesRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请求参数错误"})
+		return
+	}
+
+	before := userSnapshot(&user)
+
+	// 空字符串表示恢复默认值
+	if req.TTSVoice != nil {
+		if *req.TTSVoice != "" && !h.voices[*req.TTSVoice] {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "不支持的音色: " + *req.TTSVoice})
+			return
+		}
+		user.TTSVoice = *req.TTSVoice
+	}
+	if req.TTSRate != nil {
+		if *req.TTSRate < 0 || *req.TTSRate > 4 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "语速需在 0 到 4 之间"})
+			return
+		}
+		user.TTSRate = *req.TTSRate
+	}
+	if req.TTSPitch != nil {
+		if *req.TTSPitch != "" && !tts.ValidPitch(*req.TTSPitch) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "音调格式应为 +5Hz 或 -5Hz"})
+			return
+		}
+		user.TTSPitch = *req.TTSPitch
+	}
+
+	if err := h.db.Model(&user).Select("tts_voice", "tts_rate", "tts_pitch").Updates(&user).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "更新偏好失败"})
+		return
+	}
+
+	recordAuditChange(h.db, c, "preferences.updated", guard.UserKey(user.Username), before, userSnapshot(&user), nil)
+
+	c.JSON(http.StatusOK, user)
+}
@@ -0,0 +1,170 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"talk-web/server/middleware"
+	"talk-web/server/model"
+	"talk-web/server/pkg/telegram"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type ConversationHandler struct {
+	db   *gorm.DB
+	bots map[string]bool // 允许绑定的 bot，DefaultBot 总是允许
+}
+
+func NewConversationHandler(db *gorm.DB, bots []string) *ConversationHandler {
+	allowed := map[string]bool{telegram.DefaultBot: true}
+	for _, bot := range bots {
+		if bot = strings.TrimSpace(bot); bot != "" {
+			allowed[bot] = true
+		}
+	}
+	return &ConversationHandler{db: db, bots: allowed}
+}
+
+type CreateConversationRequest struct {
+	Title string `json:"title"`
+	Bot   string `json:"bot"`
+}
+
+type UpdateConversationRequest struct {
+	Title    *string `json:"title,omitempty"`
+	Archived *bool   `json:"archived,omitempty"`
+}
+
+// ListConversations 列出当前用户的会话（默认不含已归档，?archived=true 只看归档）
+// 拥有 conversations:view_all 权限时可以用 ?user_id= 查看其他用户的会话
+func (h *ConversationHandler) ListConversations(c *gin.Context) {
+	userID, ok := targetUserID(c)
+	if !ok {
+		return
+	}
+
+	var conversations []model.Conversation
+	err := h.db.Where("user_id = ? AND archived = ?", userID, c.Query("archived") == "true").
+		Order("updated_at desc").
+		Find(&conversations).Error
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "查询会话列表失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, conversations)
+}
+
+func (h *ConversationHandler) CreateConversation(c *gin.Context) {
+	userID := c.GetUint("user_id")
+
+	var req CreateConversationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请求参数错误"})
+		return
+	}
+
+	conversation := model.Conversation{
+		UserID: userID,
+		Title:  strings.TrimSpace(req.Title),
+		Bot:    strings.TrimSpace(req.Bot),
+	}
+	if conversation.Title == "" {
+		conversation.Title = "新对话"
+	}
+	if conversation.Bot == "" {
+		conversation.Bot = telegram.DefaultBot
+	}
+	// 消息会原样发给这个收件人，只能选择配置中允许的 bot
+	if !h.bots[conversation.Bot] {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "不支持的 bot: " + conversation.Bot})
+		return
+	}
+
+	if err := h.db.Create(&conversation).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "创建会话失败"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, conversation)
+}
+
+func (h *ConversationHandler) GetConversation(c *gin.Context) {
+	conversation, ok := h.find(c, middleware.HasPermission(c, model.PermConversationsViewAll))
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, conversation)
+}
+
+// UpdateConversation 重命名或归档/取消归档
+func (h *ConversationHandler) UpdateConversation(c *gin.Context) {
+	conversation, ok := h.find(c, false)
+	if !ok {
+		return
+	}
+
+	var req UpdateConversationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请求参数错误"})
+		return
+	}
+
+	if req.Title != nil {
+		title := strings.TrimSpace(*req.Title)
+		if title == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "标题不能为空"})
+			return
+		}
+		conversation.Title = title
+	}
+	if req.Archived != nil {
+		conversation.Archived = *req.Archived
+	}
+
+	if err := h.db.Save(conversation).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "更新会话失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, conversation)
+}
+
+// find 按路径参数查找当前用户的会话，找不到时已写入响应
+// anyUser 为 true 时不限制会话所属用户（仅用于只读访问）
+func (h *ConversationHandler) find(c *gin.Context, anyUser bool) (*model.Conversation, bool) {
+	query := h.db.Where("id = ?", c.Param("id"))
+	if !anyUser {
+		query = query.Where("user_id = ?", c.GetUint("user_id"))
+	}
+
+	var conversation model.Conversation
+	if err := query.First(&conversation).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "会话不存在"})
+		return nil, false
+	}
+	return &conversation, true
+}
+
+// targetUserID 返回要查看的用户：默认是当前用户，
+// 拥有 conversations:view_all 权限时可以通过 ?user_id= 指定其他用户，失败时已写入响应
+func targetUserID(c *gin.Context) (uint, bool) {
+	v := c.Query("user_id")
+	if v == "" {
+		return c.GetUint("user_id"), true
+	}
+
+	id, err := strconv.ParseUint(v, 10, 64)
+	if err != nil || id == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "user_id 参数无效"})
+		return 0, false
+	}
+	if uint(id) != c.GetUint("user_id") && !middleware.HasPermission(c, model.PermConversationsViewAll) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "没有查看其他用户会话的权限"})
+		return 0, false
+	}
+	return uint(id), true
+}
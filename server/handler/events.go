@@ -0,0 +1,138 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"talk-web/server/pkg/ws"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// sseHeartbeat SSE 心跳间隔，防止代理因空闲断开连接
+const sseHeartbeat = 30 * time.Second
+
+// EventsHandler Server-Sent Events 推送（WebSocket 被代理拦截时的备用通道）
+type EventsHandler struct {
+	hub *ws.Hub
+}
+
+func NewEventsHandler(hub *ws.Hub) *EventsHandler {
+	return &EventsHandler{hub: hub}
+}
+
+// Stream 建立 SSE 连接，推送与 WebSocket 相同的 ws.Message
+func (h *EventsHandler) Stream(c *gin.Context) {
+	userID := c.GetUint("user_id")
+	username := c.GetString("username")
+
+	deviceID := c.Query("device_id")
+	if deviceID == "" {
+		deviceID = newDeviceID()
+	}
+
+	client := ws.NewClient(userID, username, deviceID, c.GetUint("session_id"), h.hub, nil)
+	h.hub.Register(client)
+	defer h.hub.Unregister(client)
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no") // 关闭 nginx 缓冲
+
+	// 断线重连：浏览器自动带 Last-Event-ID，也兼容 query 参数
+	lastEventID := c.GetHeader("Last-Event-ID")
+	if lastEventID == "" {
+		lastEventID = c.Query("last_event_id")
+	}
+	// 补发直接写到响应中；注册后到达的新事件暂存在 client 中，已补发过的跳过
+	var replayed uint64
+	if lastEventID != "" {
+		if id, err := strconv.ParseUint(lastEventID, 10, 64); err == nil {
+			replayed, err = h.hub.Replay(userID, id, func(msg *ws.Message) error {
+				if err := writeSSE(c.Writer, msg); err != nil {
+					return err
+				}
+				c.Writer.Flush()
+				return nil
+			})
+			if err != nil {
+				log.Printf("SSE replay error: user=%d %v", userID, err)
+				return
+			}
+		}
+	}
+
+	h.hub.SendToDevice(userID, deviceID, "status", map[string]interface{}{
+		"event":     "connected",
+		"device_id": deviceID,
+		"devices":   h.hub.Devices(userID),
+	})
+
+	log.Printf("SSE connected: user=%d (%s) device=%s", userID, username, deviceID)
+
+	heartbeat := time.NewTicker(sseHeartbeat)
+	defer heartbeat.Stop()
+
+	c.Stream(func(w io.Writer) bool {
+		select {
+		case <-c.Request.Context().Done():
+			return false
+
+		case msg, ok := <-client.Messages():
+			if !ok {
+				return false
+			}
+			if msg.ID != 0 && msg.ID <= replayed {
+				return true
+			}
+			if err := writeSSE(w, msg); err != nil {
+				log.Printf("SSE write error: %v", err)
+				return false
+			}
+			return true
+
+		case <-heartbeat.C:
+			_, err := io.WriteString(w, ": ping\n\n")
+			return err == nil
+		}
+	})
+
+	log.Printf("SSE disconnected: user=%d (%s) device=%s", userID, username, deviceID)
+}
+
+type AckRequest struct {
+	ID uint64 `json:"id" binding:"required"`
+}
+
+// Ack 确认已收到的事件（SSE 没有上行通道，用普通请求代替 WebSocket 的 ack 消息）
+func (h *EventsHandler) Ack(c *gin.Context) {
+	var req AckRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请求参数错误"})
+		return
+	}
+
+	h.hub.Ack(c.GetUint("user_id"), req.ID)
+	c.JSON(http.StatusOK, gin.H{"message": "ok"})
+}
+
+// writeSSE 按 SSE 格式写出一条消息，事件名为消息类型
+func writeSSE(w io.Writer, msg *ws.Message) error {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+
+	if msg.ID > 0 {
+		if _, err := fmt.Fprintf(w, "id: %d\n", msg.ID); err != nil {
+			return err
+		}
+	}
+	_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", msg.Type, data)
+	return err
+}
@@ -0,0 +1,62 @@
+package handler
+
+import (
+	"fmt"
+	"net/http"
+	"talk-web/server/model"
+	"talk-web/server/pkg/export"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type ExportHandler struct {
+	db *gorm.DB
+}
+
+func NewExportHandler(db *gorm.DB) *ExportHandler {
+	return &ExportHandler{db: db}
+}
+
+// Export 导出当前用户（或其某个会话）的历史记录
+// GET /api/export?format=json|markdown|zip&conversation_id=1
+func (h *ExportHandler) Export(c *gin.Context) {
+	userID := c.GetUint("user_id")
+
+	format := c.DefaultQuery("format", export.FormatJSON)
+	contentType, ext, err := export.ContentType(format)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "不支持的导出格式"})
+		return
+	}
+
+	conversationID, err := parseConversationID(c.Query("conversation_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if conversationID != 0 {
+		var count int64
+		h.db.Model(&model.Conversation{}).Where("id = ? AND user_id = ?", conversationID, userID).Count(&count)
+		if count == 0 {
+			c.JSON(http.StatusNotFound, gin.H{"error": "会话不存在"})
+			return
+		}
+	}
+
+	exporter := export.New(h.db, export.Options{
+		UserID:         userID,
+		ConversationID: conversationID,
+	})
+
+	filename := fmt.Sprintf("talk-export-%s%s", time.Now().Format("20060102-150405"), ext)
+	c.Header("Content-Type", contentType)
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, filename))
+	c.Status(http.StatusOK)
+
+	// 响应头已发出，出错时只能记录日志并中断输出
+	if err := exporter.Write(c.Writer, format); err != nil {
+		fmt.Printf("[Export Error] user=%d: %v\n", userID, err)
+	}
+}
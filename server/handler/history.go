@@ -0,0 +1,212 @@
+package handler
+
+import (
+	"html"
+	"net/http"
+	"strconv"
+	"strings"
+	"talk-web/server/model"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	defaultHistoryLimit = 20
+	maxHistoryLimit     = 100
+	snippetRadius       = 30 // 高亮片段中匹配词两侧保留的字符数
+)
+
+// HistoryItem 历史消息，搜索时附带高亮片段
+type HistoryItem struct {
+	model.Message
+	Highlight *Highlight `json:"highlight,omitempty"`
+}
+
+// Highlight 搜索命中的片段，匹配部分用 <mark> 包裹，其余内容已做 HTML 转义
+type Highlight struct {
+	Text  string `json:"text,omitempty"`
+	Reply string `json:"reply,omitempty"`
+}
+
+// GetHistory 获取用户的对话历史（按时间倒序，游标分页）
+//
+// 查询参数：
+//   - limit: 每页条数（默认 20，最大 100）
+//   - cursor: 上一页返回的 next_cursor
+//   - conversation_id: 只看某个会话
+//   - status: sent / replied / timeout 等
+//   - from, to: 时间范围（RFC3339 或 2006-01-02，to 为日期时包含当天）
+//   - q: 全文搜索 Text 和 Reply（pg_trgm 索引，适合中文）
+//   - user_id: 查看其他用户的历史（需要 conversations:view_all 权限）
+func (h *UploadHandler) GetHistory(c *gin.Context) {
+	userID, ok := targetUserID(c)
+	if !ok {
+		return
+	}
+
+	limit := defaultHistoryLimit
+	if v := c.Query("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "limit 参数无效"})
+			return
+		}
+		if n > maxHistoryLimit {
+			n = maxHistoryLimit
+		}
+		limit = n
+	}
+
+	query, err := h.scopeMessages(c, userID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// 游标是上一页最后一条消息的 ID（ID 与创建时间同序）
+	if v := c.Query("cursor"); v != "" {
+		cursor, err := strconv.ParseUint(v, 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "cursor 参数无效"})
+			return
+		}
+		query = query.Where("id < ?", cursor)
+	}
+
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+
+	if v := c.Query("from"); v != "" {
+		from, _, err := parseTimeParam(v)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "from 参数无效"})
+			return
+		}
+		query = query.Where("created_at >= ?", from)
+	}
+	if v := c.Query("to"); v != "" {
+		to, dateOnly, err := parseTimeParam(v)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "to 参数无效"})
+			return
+		}
+		if dateOnly {
+			to = to.AddDate(0, 0, 1)
+		}
+		query = query.Where("created_at < ?", to)
+	}
+
+	keyword := strings.TrimSpace(c.Query("q"))
+	if keyword != "" {
+		pattern := "%" + escapeLike(keyword) + "%"
+		query = query.Where("(text ILIKE ? OR reply ILIKE ?)", pattern, pattern)
+	}
+
+	// 多取一条用于判断是否还有下一页
+	var messages []model.Message
+	if err := query.Order("id desc").Limit(limit + 1).Find(&messages).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "获取历史记录失败",
+		})
+		return
+	}
+
+	hasMore := len(messages) > limit
+	if hasMore {
+		messages = messages[:limit]
+	}
+
+	items := make([]HistoryItem, 0, len(messages))
+	for _, m := range messages {
+		item := HistoryItem{Message: m}
+		if keyword != "" {
+			item.Highlight = &Highlight{
+				Text:  highlight(m.Text, keyword),
+				Reply: highlight(m.Reply, keyword),
+			}
+		}
+		items = append(items, item)
+	}
+
+	resp := gin.H{
+		"messages": items,
+		"count":    len(items),
+		"has_more": hasMore,
+	}
+	if hasMore {
+		resp["next_cursor"] = strconv.FormatUint(uint64(messages[len(messages)-1].ID), 10)
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// parseTimeParam 解析 RFC3339 或日期，第二个返回值表示是否只有日期
+func parseTimeParam(v string) (time.Time, bool, error) {
+	if t, err := time.Parse(time.RFC3339, v); err == nil {
+		return t, false, nil
+	}
+	t, err := time.ParseInLocation("2006-01-02", v, time.Local)
+	return t, true, err
+}
+
+// escapeLike 转义 LIKE 模式中的通配符
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
+
+// highlight 截取第一个匹配附近的片段并用 <mark> 标出匹配部分，未命中时返回空
+func highlight(text, keyword string) string {
+	runes := []rune(text)
+	lower := []rune(strings.ToLower(text))
+	key := []rune(strings.ToLower(keyword))
+
+	// ToLower 可能改变个别字符的长度，这种情况下无法对齐，放弃高亮
+	if len(lower) != len(runes) || len(key) == 0 {
+		return ""
+	}
+
+	idx := indexRunes(lower, key)
+	if idx < 0 {
+		return ""
+	}
+
+	start := idx - snippetRadius
+	if start < 0 {
+		start = 0
+	}
+	end := idx + len(key) + snippetRadius
+	if end > len(runes) {
+		end = len(runes)
+	}
+
+	var b strings.Builder
+	if start > 0 {
+		b.WriteString("…")
+	}
+	b.WriteString(html.EscapeString(string(runes[start:idx])))
+	b.WriteString("<mark>")
+	b.WriteString(html.EscapeString(string(runes[idx : idx+len(key)])))
+	b.WriteString("</mark>")
+	b.WriteString(html.EscapeString(string(runes[idx+len(key) : end])))
+	if end < len(runes) {
+		b.WriteString("…")
+	}
+	return b.String()
+}
+
+func indexRunes(s, sub []rune) int {
+	for i := 0; i+len(sub) <= len(s); i++ {
+		match := true
+		for j := range sub {
+			if s[i+j] != sub[j] {
+				match = false
+				break
+			}
+		}
+		if match {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,40 @@
+package handler
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestHighlight(t *testing.T) {
+	pad := func(s string) string { return strings.Repeat(s, snippetRadius) }
+
+	tests := []struct {
+		name    string
+		text    string
+		keyword string
+		want    string
+	}{
+		{name: "case insensitive", text: "Hello World", keyword: "world", want: "Hello <mark>World</mark>"},
+		{name: "first match only", text: "foo bar foo", keyword: "foo", want: "<mark>foo</mark> bar foo"},
+		{name: "chinese", text: "今天天气很好", keyword: "天气", want: "今天<mark>天气</mark>很好"},
+		{name: "escapes html", text: "<b>x</b> & y", keyword: "x", want: "&lt;b&gt;<mark>x</mark>&lt;/b&gt; &amp; y"},
+		{name: "escapes keyword", text: "a<b", keyword: "<", want: "a<mark>&lt;</mark>b"},
+		{
+			name:    "truncates both sides",
+			text:    "a" + pad("a") + "key" + pad("b") + "b",
+			keyword: "key",
+			want:    "…" + pad("a") + "<mark>key</mark>" + pad("b") + "…",
+		},
+		{name: "fits exactly", text: pad("a") + "key" + pad("b"), keyword: "key", want: pad("a") + "<mark>key</mark>" + pad("b")},
+		{name: "no match", text: "Hello", keyword: "bye", want: ""},
+		{name: "empty keyword", text: "Hello", keyword: "", want: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := highlight(tt.text, tt.keyword); got != tt.want {
+				t.Errorf("highlight(%q, %q) = %q, want %q", tt.text, tt.keyword, got, tt.want)
+			}
+		})
+	}
+}
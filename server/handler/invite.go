@@ -0,0 +1,298 @@
+package handler
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"talk-web/server/model"
+	"talk-web/server/pkg/guard"
+	"talk-web/server/pkg/password"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const (
+	invitePrefix     = "inv_"
+	defaultInviteTTL = 7 * 24 * time.Hour
+	maxInviteTTL     = 90 * 24 * time.Hour
+	maxInviteUses    = 1000
+)
+
+var (
+	errPendingApproval = errors.New("账号等待管理员审核")
+	errInvalidInvite   = errors.New("邀请码无效或已过期")
+	errUsernameTaken   = errors.New("用户名已存在")
+)
+
+type InviteHandler struct {
+	db     *gorm.DB
+	guard  *guard.LoginGuard
+	policy *password.Policy
+}
+
+func NewInviteHandler(db *gorm.DB, loginGuard *guard.LoginGuard, policy *password.Policy) *InviteHandler {
+	return &InviteHandler{db: db, guard: loginGuard, policy: policy}
+}
+
+type CreateInviteRequest struct {
+	Role            string     `json:"role"`     // 默认 user
+	MaxUses         int        `json:"max_uses"` // 默认 1（单次使用）
+	RequireApproval bool       `json:"require_approval"`
+	Note            string     `json:"note"`
+	ExpiresAt       *time.Time `json:"expires_at"` // 默认 7 天后
+}
+
+type CreateInviteResponse struct {
+	model.Invite
+	Code string `json:"code"` // 明文只返回这一次
+}
+
+type RegisterRequest struct {
+	InviteCode string `json:"invite_code" binding:"required"`
+	Username   string `json:"username" binding:"required"`
+	Password   string `json:"password" binding:"required"`
+}
+
+// ListInvites 列出邀请码，默认只列出仍可使用的，?all=true 列出全部
+func (h *InviteHandler) ListInvites(c *gin.Context) {
+	query := h.db.Order("created_at desc")
+	if c.Query("all") != "true" {
+		query = query.Where("revoked_at IS NULL AND expires_at > ? AND uses < max_uses", time.Now())
+	}
+
+	var invites []model.Invite
+	if err := query.Find(&invites).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "查询邀请码失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, invites)
+}
+
+// CreateInvite 生成邀请码
+func (h *InviteHandler) CreateInvite(c *gin.Context) {
+	var req CreateInviteRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请求参数错误"})
+		return
+	}
+
+	if req.Role == "" {
+		req.Role = model.RoleUser
+	}
+	if !model.ValidRole(req.Role) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "未知的角色: " + req.Role})
+		return
+	}
+	if req.MaxUses == 0 {
+		req.MaxUses = 1
+	}
+	if req.MaxUses < 0 || req.MaxUses > maxInviteUses {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "使用次数无效"})
+		return
+	}
+
+	expiresAt := time.Now().Add(defaultInviteTTL)
+	if req.ExpiresAt != nil {
+		if !req.ExpiresAt.After(time.Now()) || req.ExpiresAt.After(time.Now().Add(maxInviteTTL)) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "过期时间必须在 90 天以内"})
+			return
+		}
+		expiresAt = *req.ExpiresAt
+	}
+
+	code, err := newInviteCode()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "生成邀请码失败"})
+		return
+	}
+
+	invite := model.Invite{
+		Prefix:          code[:len(invitePrefix)+6],
+		CodeHash:        hashToken(code),
+		Role:            req.Role,
+		MaxUses:         req.MaxUses,
+		RequireApproval: req.RequireApproval,
+		Note:            req.Note,
+		CreatedBy:       c.GetUint("user_id"),
+		ExpiresAt:       expiresAt,
+	}
+	if err := h.db.Create(&invite).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "创建邀请码失败"})
+		return
+	}
+
+	recordAudit(h.db, c, "invite.created", "invite:"+invite.Prefix, "", gin.H{
+		"role":             invite.Role,
+		"max_uses":         invite.MaxUses,
+		"require_approval": invite.RequireApproval,
+		"expires_at":       invite.ExpiresAt,
+	})
+	c.JSON(http.StatusCreated, CreateInviteResponse{Invite: invite, Code: code})
+}
+
+// RevokeInvite 撤销邀请码，已注册的用户不受影响
+func (h *InviteHandler) RevokeInvite(c *gin.Context) {
+	var invite model.Invite
+	if err := h.db.Where("id = ? AND revoked_at IS NULL", c.Param("id")).First(&invite).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "邀请码不存在"})
+		return
+	}
+
+	if err := h.db.Model(&invite).Update("revoked_at", time.Now()).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "撤销邀请码失败"})
+		return
+	}
+
+	recordAudit(h.db, c, "invite.revoked", "invite:"+invite.Prefix, "", nil)
+	c.JSON(http.StatusOK, gin.H{"message": "邀请码已撤销"})
+}
+
+// Register 使用邀请码自助注册
+// 邀请要求审核时账号创建后处于待审核状态，批准前不能登录
+func (h *InviteHandler) Register(c *gin.Context) {
+	var req RegisterRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请求参数错误"})
+		return
+	}
+
+	req.Username = strings.TrimSpace(req.Username)
+	if req.Username == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "用户名不能为空"})
+		return
+	}
+	if err := h.policy.Validate(req.Password, req.Username); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// 注册接口无需登录，按 IP 限流，防止穷举邀请码
+	ip := c.ClientIP()
+	wait, err := h.guard.CheckIP(ip)
+	if err != nil {
+		// 限流存储不可用时不阻止注册
+		fmt.Printf("[Login Guard Error] %v\n", err)
+	}
+	if wait > 0 {
+		c.Header("Retry-After", strconv.Itoa(retrySeconds(wait)))
+		c.JSON(http.StatusTooManyRequests, gin.H{
+			"error":       fmt.Sprintf("尝试次数过多，请 %d 秒后再试", retrySeconds(wait)),
+			"retry_after": retrySeconds(wait),
+		})
+		return
+	}
+
+	// 先确认邀请码有效再做耗时的密码哈希，无效请求不消耗 bcrypt
+	var invite model.Invite
+	if err := h.db.Where("code_hash = ? AND revoked_at IS NULL AND expires_at > ? AND uses < max_uses",
+		hashToken(strings.TrimSpace(req.InviteCode)), time.Now()).First(&invite).Error; err != nil {
+		if err := h.guard.FailIP(ip); err != nil {
+			fmt.Printf("[Login Guard Error] %v\n", err)
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": errInvalidInvite.Error()})
+		return
+	}
+
+	user := model.User{Username: req.Username}
+	if err := user.SetPassword(req.Password); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "密码加密失败"})
+		return
+	}
+
+	err = h.db.Transaction(func(tx *gorm.DB) error {
+		// 条件更新占用一次名额，并发注册时不会超过 max_uses
+		result := tx.Model(&model.Invite{}).
+			Where("id = ? AND revoked_at IS NULL AND expires_at > ? AND uses < max_uses", invite.ID, time.Now()).
+			UpdateColumn("uses", gorm.Expr("uses + 1"))
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errInvalidInvite
+		}
+
+		var count int64
+		tx.Unscoped().Model(&model.User{}).Where("username = ?", req.Username).Count(&count)
+		if count > 0 {
+			return errUsernameTaken
+		}
+
+		user.Role = invite.Role
+		user.PendingApproval = invite.RequireApproval
+		user.InviteID = &invite.ID
+		return tx.Create(&user).Error
+	})
+	switch {
+	case errors.Is(err, errInvalidInvite):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	case errors.Is(err, errUsernameTaken):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "注册失败"})
+		return
+	}
+
+	// 注册者没有登录，审计记录以新用户自己为操作人
+	c.Set("user_id", user.ID)
+	c.Set("username", user.Username)
+	recordAuditChange(h.db, c, "user.registered", guard.UserKey(user.Username), nil, userSnapshot(&user), gin.H{"invite": invite.Prefix})
+
+	if user.PendingApproval {
+		c.JSON(http.StatusAccepted, gin.H{"message": "注册成功，请等待管理员审核", "pending_approval": true})
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{"message": "注册成功，请登录", "pending_approval": false})
+}
+
+// ListPendingUsers 列出等待审核的用户
+func (h *InviteHandler) ListPendingUsers(c *gin.Context) {
+	var users []model.User
+	if err := h.db.Where("pending_approval = ?", true).Order("created_at").Find(&users).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "查询待审核用户失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, users)
+}
+
+// ApproveUser 批准待审核用户，之后即可正常登录
+// 拒绝注册直接删除用户即可
+func (h *InviteHandler) ApproveUser(c *gin.Context) {
+	var user model.User
+	if err := h.db.First(&user, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "用户不存在"})
+		return
+	}
+	if !user.PendingApproval {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "该用户不需要审核"})
+		return
+	}
+
+	before := userSnapshot(&user)
+	user.PendingApproval = false
+	if err := h.db.Model(&user).Update("pending_approval", false).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "审核用户失败"})
+		return
+	}
+
+	recordAuditChange(h.db, c, "user.approved", guard.UserKey(user.Username), before, userSnapshot(&user), nil)
+	c.JSON(http.StatusOK, user)
+}
+
+// newInviteCode 生成带前缀的随机邀请码
+func newInviteCode() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return invitePrefix + hex.EncodeToString(b), nil
+}
@@ -0,0 +1,445 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"talk-web/server/middleware"
+	"talk-web/server/model"
+	"talk-web/server/pkg/guard"
+	"talk-web/server/pkg/oidc"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"gorm.io/gorm"
+)
+
+const (
+	oidcStateCookie = "oidc_state"
+	oidcStateTTL    = 10 * time.Minute
+	oidcStateAud    = "oidc_state" // 与访问令牌区分，避免互相冒用
+)
+
+// 登录完成后跳转回前端的地址
+const (
+	oidcLoginRedirect = "/login/callback"
+	oidcLinkRedirect  = "/talk"
+	oidcErrorRedirect = "/login"
+)
+
+var errIdentityLinked = errors.New("该外部账号已关联其他用户")
+
+// OIDCHandler OpenID Connect 授权码 + PKCE 登录
+type OIDCHandler struct {
+	db            *gorm.DB
+	provider      *oidc.Provider // 为 nil 表示未启用
+	refreshTTL    time.Duration
+	adminGroup    string // 属于该用户组的身份提供方用户获得管理员角色
+	autoProvision bool   // 首次登录时自动创建本地用户
+	trustIdPMFA   bool   // 信任身份提供方的多因素认证，开启了两步验证的用户不再校验验证码
+}
+
+func NewOIDCHandler(db *gorm.DB, provider *oidc.Provider, refreshTTL time.Duration, adminGroup string, autoProvision, trustIdPMFA bool) *OIDCHandler {
+	return &OIDCHandler{
+		db:            db,
+		provider:      provider,
+		refreshTTL:    refreshTTL,
+		adminGroup:    adminGroup,
+		autoProvision: autoProvision,
+		trustIdPMFA:   trustIdPMFA,
+	}
+}
+
+// oidcState 授权过程中保存在 cookie 里的状态，用 JWT 密钥签名
+type oidcState struct {
+	State      string `json:"state"`
+	Nonce      string `json:"nonce"`
+	Verifier   string `json:"verifier"`
+	LinkUserID uint   `json:"link_uid,omitempty"` // 不为 0 表示为已登录用户关联外部账号
+	jwt.RegisteredClaims
+}
+
+// Config 前端据此决定是否显示单点登录按钮
+func (h *OIDCHandler) Config(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"enabled": h.provider != nil})
+}
+
+// Login 跳转到身份提供方登录
+func (h *OIDCHandler) Login(c *gin.Context) {
+	if h.provider == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "未启用单点登录"})
+		return
+	}
+
+	authURL, err := h.begin(c, 0)
+	if err != nil {
+		fmt.Printf("[OIDC Error] %v\n", err)
+		h.redirectError(c, "无法连接身份提供方")
+		return
+	}
+	c.Redirect(http.StatusFound, authURL)
+}
+
+// Link 为当前用户关联外部账号，返回授权地址由前端跳转
+// 状态 cookie 在这次请求中设置，回调时据此识别要关联的用户
+func (h *OIDCHandler) Link(c *gin.Context) {
+	if h.provider == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "未启用单点登录"})
+		return
+	}
+
+	authURL, err := h.begin(c, c.GetUint("user_id"))
+	if err != nil {
+		fmt.Printf("[OIDC Error] %v\n", err)
+		c.JSON(http.StatusBadGateway, gin.H{"error": "无法连接身份提供方"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"url": authURL})
+}
+
+// begin 生成 state、nonce、PKCE 参数，写入签名 cookie 并返回授权地址
+func (h *OIDCHandler) begin(c *gin.Context, linkUserID uint) (string, error) {
+	state, err := oidc.RandomString(16)
+	if err != nil {
+		return "", err
+	}
+	nonce, err := oidc.RandomString(16)
+	if err != nil {
+		return "", err
+	}
+	verifier, challenge, err := oidc.NewPKCE()
+	if err != nil {
+		return "", err
+	}
+
+	authURL, err := h.provider.AuthURL(c.Request.Context(), state, nonce, challenge)
+	if err != nil {
+		return "", err
+	}
+
+	claims := oidcState{
+		State:      state,
+		Nonce:      nonce,
+		Verifier:   verifier,
+		LinkUserID: linkUserID,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Audience:  jwt.ClaimStrings{oidcStateAud},
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(oidcStateTTL)),
+		},
+	}
+	signed, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(middleware.GetJWTSecret())
+	if err != nil {
+		return "", err
+	}
+
+	h.setStateCookie(c, signed, int(oidcStateTTL.Seconds()))
+	return authURL, nil
+}
+
+// Callback 身份提供方回调：校验 state，换取并校验 ID token，然后登录或关联账号
+func (h *OIDCHandler) Callback(c *gin.Context) {
+	if h.provider == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "未启用单点登录"})
+		return
+	}
+
+	raw, _ := c.Cookie(oidcStateCookie)
+	h.setStateCookie(c, "", -1) // state 只能使用一次
+
+	if e := c.Query("error"); e != "" {
+		h.redirectError(c, "身份提供方拒绝了登录: "+e)
+		return
+	}
+
+	state, err := h.parseState(raw)
+	if err != nil || state.State != c.Query("state") {
+		h.redirectError(c, "登录状态无效或已过期，请重试")
+		return
+	}
+
+	claims, err := h.provider.Exchange(c.Request.Context(), c.Query("code"), state.Verifier, state.Nonce)
+	if err != nil {
+		fmt.Printf("[OIDC Error] %v\n", err)
+		recordAudit(h.db, c, "login.oidc_failed", "", "", gin.H{"error": err.Error()})
+		h.redirectError(c, "单点登录失败")
+		return
+	}
+
+	if state.LinkUserID != 0 {
+		h.link(c, state.LinkUserID, claims)
+		return
+	}
+	h.login(c, claims)
+}
+
+// link 把外部账号关联到已登录的用户
+func (h *OIDCHandler) link(c *gin.Context, userID uint, claims *oidc.Claims) {
+	var user model.User
+	if err := h.db.First(&user, userID).Error; err != nil {
+		h.redirectError(c, "用户不存在")
+		return
+	}
+
+	var existing model.ExternalIdentity
+	err := h.db.Where("issuer = ? AND subject = ?", h.provider.Issuer(), claims.Subject).First(&existing).Error
+	if err == nil && existing.UserID != user.ID {
+		h.redirectError(c, errIdentityLinked.Error())
+		return
+	}
+	if err == nil {
+		c.Redirect(http.StatusFound, oidcLinkRedirect) // 已经关联过
+		return
+	}
+
+	identity := model.ExternalIdentity{
+		UserID:  user.ID,
+		Issuer:  h.provider.Issuer(),
+		Subject: claims.Subject,
+		Email:   claims.Email,
+
+		EmailVerified: claims.EmailVerified,
+	}
+	if err := h.db.Create(&identity).Error; err != nil {
+		h.redirectError(c, "关联外部账号失败")
+		return
+	}
+
+	c.Set("user_id", user.ID)
+	c.Set("username", user.Username)
+	recordAudit(h.db, c, "identity.linked", guard.UserKey(user.Username), "", gin.H{"issuer": identity.Issuer, "subject": identity.Subject})
+	c.Redirect(http.StatusFound, oidcLinkRedirect)
+}
+
+// login 按外部身份找到（或创建）本地用户并签发会话
+func (h *OIDCHandler) login(c *gin.Context, claims *oidc.Claims) {
+	var identity model.ExternalIdentity
+	var user model.User
+
+	err := h.db.Where("issuer = ? AND subject = ?", h.provider.Issuer(), claims.Subject).First(&identity).Error
+	switch {
+	case err == nil:
+		if err := h.db.First(&user, identity.UserID).Error; err != nil {
+			h.redirectError(c, "关联的用户已被删除")
+			return
+		}
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		if !h.autoProvision {
+			h.redirectError(c, "该外部账号尚未关联本地用户")
+			return
+		}
+		created, createdIdentity, err := h.provision(claims)
+		if err != nil {
+			fmt.Printf("[OIDC Error] provision failed: %v\n", err)
+			h.redirectError(c, "创建用户失败")
+			return
+		}
+		user, identity = *created, *createdIdentity
+	default:
+		h.redirectError(c, "查询外部账号失败")
+		return
+	}
+
+	if user.PendingApproval {
+		h.redirectError(c, errPendingApproval.Error())
+		return
+	}
+
+	before := userSnapshot(&user)
+	if err := h.syncRole(&user, &identity, claims.Groups); err != nil {
+		h.redirectError(c, "同步用户角色失败")
+		return
+	}
+
+	now := time.Now()
+	h.db.Model(&identity).Updates(map[string]interface{}{
+		"last_login_at":  now,
+		"email":          claims.Email,
+		"email_verified": claims.EmailVerified,
+	})
+
+	// 开启了两步验证的用户和密码登录一样需要输入验证码，除非明确信任身份提供方的多因素认证
+	if user.TOTPEnabled && !h.trustIdPMFA {
+		challenge, err := signChallenge(&user, "sso")
+		if err != nil {
+			h.redirectError(c, "生成token失败")
+			return
+		}
+		fragment := url.Values{}
+		fragment.Set("challenge_token", challenge)
+		fragment.Set("expires_in", fmt.Sprint(int(challengeTTL.Seconds())))
+		c.Redirect(http.StatusFound, oidcLoginRedirect+"#"+fragment.Encode())
+		return
+	}
+
+	tokens, err := issueSession(h.db, c, &user, "sso", h.refreshTTL)
+	if err != nil {
+		h.redirectError(c, "生成token失败")
+		return
+	}
+
+	c.Set("user_id", user.ID)
+	c.Set("username", user.Username)
+	recordAuditChange(h.db, c, "login.succeeded", guard.UserKey(user.Username), before, userSnapshot(&user), gin.H{"method": "oidc", "issuer": identity.Issuer})
+
+	// 令牌放在 fragment 中，不会发送到服务器或出现在访问日志里
+	fragment := url.Values{}
+	fragment.Set("token", tokens.Token)
+	fragment.Set("refresh_token", tokens.RefreshToken)
+	fragment.Set("expires_in", fmt.Sprint(tokens.ExpiresIn))
+	c.Redirect(http.StatusFound, oidcLoginRedirect+"#"+fragment.Encode())
+}
+
+// provision 首次登录时创建本地用户（随机密码，只能通过单点登录）
+func (h *OIDCHandler) provision(claims *oidc.Claims) (*model.User, *model.ExternalIdentity, error) {
+	password, err := oidc.RandomString(32)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var user model.User
+	var identity model.ExternalIdentity
+	err = h.db.Transaction(func(tx *gorm.DB) error {
+		username, err := uniqueUsername(tx, claims)
+		if err != nil {
+			return err
+		}
+
+		user = model.User{Username: username, Role: model.RoleUser}
+		if err := user.SetPassword(password); err != nil {
+			return err
+		}
+		if err := tx.Create(&user).Error; err != nil {
+			return err
+		}
+
+		identity = model.ExternalIdentity{
+			UserID:      user.ID,
+			Issuer:      h.provider.Issuer(),
+			Subject:     claims.Subject,
+			Email:       claims.Email,
+			Provisioned: true,
+
+			EmailVerified: claims.EmailVerified,
+		}
+		return tx.Create(&identity).Error
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return &user, &identity, nil
+}
+
+// syncRole 属于管理员组的用户升为管理员；自动创建的用户离开该组后降为普通用户
+// 手动关联的本地用户只会被升级，不会因为用户组被降级
+func (h *OIDCHandler) syncRole(user *model.User, identity *model.ExternalIdentity, groups []string) error {
+	if h.adminGroup == "" {
+		return nil
+	}
+
+	role := user.Role
+	inGroup := false
+	for _, g := range groups {
+		if g == h.adminGroup {
+			inGroup = true
+			break
+		}
+	}
+	switch {
+	case inGroup:
+		role = model.RoleAdmin
+	case identity.Provisioned && user.Role == model.RoleAdmin:
+		role = model.RoleUser
+	}
+
+	if role == user.Role {
+		return nil
+	}
+	user.Role = role
+	return h.db.Model(user).Select("role", "is_admin").Updates(user).Error
+}
+
+// ListIdentities 列出当前用户关联的外部账号
+func (h *OIDCHandler) ListIdentities(c *gin.Context) {
+	var identities []model.ExternalIdentity
+	if err := h.db.Where("user_id = ?", c.GetUint("user_id")).Order("created_at").Find(&identities).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "查询外部账号失败"})
+		return
+	}
+	c.JSON(http.StatusOK, identities)
+}
+
+// UnlinkIdentity 取消关联外部账号
+func (h *OIDCHandler) UnlinkIdentity(c *gin.Context) {
+	var identity model.ExternalIdentity
+	if err := h.db.Where("id = ? AND user_id = ?", c.Param("id"), c.GetUint("user_id")).First(&identity).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "外部账号不存在"})
+		return
+	}
+
+	if err := h.db.Delete(&identity).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "取消关联失败"})
+		return
+	}
+
+	recordAudit(h.db, c, "identity.unlinked", guard.UserKey(c.GetString("username")), "", gin.H{"issuer": identity.Issuer, "subject": identity.Subject})
+	c.JSON(http.StatusOK, gin.H{"message": "已取消关联"})
+}
+
+func (h *OIDCHandler) parseState(raw string) (*oidcState, error) {
+	if raw == "" {
+		return nil, errors.New("missing state cookie")
+	}
+	state := &oidcState{}
+	_, err := jwt.ParseWithClaims(raw, state, func(token *jwt.Token) (interface{}, error) {
+		return middleware.GetJWTSecret(), nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}), jwt.WithAudience(oidcStateAud))
+	if err != nil {
+		return nil, err
+	}
+	return state, nil
+}
+
+// setStateCookie 回调是身份提供方发起的顶级跳转，需要 SameSite=Lax 才能带上 cookie
+func (h *OIDCHandler) setStateCookie(c *gin.Context, value string, maxAge int) {
+	secure := c.Request.TLS != nil || c.GetHeader("X-Forwarded-Proto") == "https"
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(oidcStateCookie, value, maxAge, "/api/auth/oidc", "", secure, true)
+}
+
+func (h *OIDCHandler) redirectError(c *gin.Context, msg string) {
+	c.Redirect(http.StatusFound, oidcErrorRedirect+"?error="+url.QueryEscape(msg))
+}
+
+var usernameInvalid = regexp.MustCompile(`[^a-zA-Z0-9._-]+`)
+
+// uniqueUsername 根据身份提供方的用户名或邮箱生成未被占用的本地用户名
+func uniqueUsername(tx *gorm.DB, claims *oidc.Claims) (string, error) {
+	base := claims.PreferredUsername
+	if base == "" && claims.Email != "" {
+		base, _, _ = strings.Cut(claims.Email, "@")
+	}
+	base = strings.Trim(usernameInvalid.ReplaceAllString(base, "-"), "-")
+	if base == "" {
+		base = "sso-user"
+	}
+
+	for i := 1; i <= 100; i++ {
+		candidate := base
+		if i > 1 {
+			candidate = fmt.Sprintf("%s-%d", base, i)
+		}
+		var count int64
+		// 包括已软删除的用户，用户名有唯一约束
+		if err := tx.Unscoped().Model(&model.User{}).Where("username = ?", candidate).Count(&count).Error; err != nil {
+			return "", err
+		}
+		if count == 0 {
+			return candidate, nil
+		}
+	}
+	return "", fmt.Errorf("no available username for %q", base)
+}
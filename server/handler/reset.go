@@ -0,0 +1,224 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"talk-web/server/model"
+	"talk-web/server/pkg/guard"
+	"talk-web/server/pkg/mail"
+	"talk-web/server/pkg/password"
+	"talk-web/server/pkg/ws"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+var errInvalidResetToken = errors.New("重置链接无效或已过期")
+
+// PasswordResetHandler 管理员发起的密码重置
+type PasswordResetHandler struct {
+	db        *gorm.DB
+	hub       *ws.Hub
+	guard     *guard.LoginGuard
+	policy    *password.Policy
+	mailer    *mail.Mailer
+	ttl       time.Duration
+	publicURL string // 前端地址，用于拼接重置链接
+}
+
+func NewPasswordResetHandler(db *gorm.DB, hub *ws.Hub, loginGuard *guard.LoginGuard, policy *password.Policy, mailer *mail.Mailer, ttl time.Duration, publicURL string) *PasswordResetHandler {
+	return &PasswordResetHandler{
+		db:        db,
+		hub:       hub,
+		guard:     loginGuard,
+		policy:    policy,
+		mailer:    mailer,
+		ttl:       ttl,
+		publicURL: strings.TrimRight(publicURL, "/"),
+	}
+}
+
+type CreatePasswordResetRequest struct {
+	SendEmail bool   `json:"send_email"` // 通过 SMTP 发给用户，否则把链接返回给管理员转交
+	Email     string `json:"email"`      // 为空时使用用户关联外部账号的邮箱
+}
+
+type ResetPasswordRequest struct {
+	Token       string `json:"token" binding:"required"`
+	NewPassword string `json:"new_password" binding:"required"`
+}
+
+// CreatePasswordReset 为用户生成一次性重置链接，之前未使用的链接随之作废
+func (h *PasswordResetHandler) CreatePasswordReset(c *gin.Context) {
+	var user model.User
+	if err := h.db.First(&user, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "用户不存在"})
+		return
+	}
+
+	var req CreatePasswordResetRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请求参数错误"})
+		return
+	}
+
+	email := strings.TrimSpace(req.Email)
+	if req.SendEmail {
+		if !h.mailer.Enabled() {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "未配置 SMTP，无法发送邮件"})
+			return
+		}
+		if email == "" {
+			var identity model.ExternalIdentity
+			// 只使用身份提供方验证过的邮箱，未验证的地址可能被任何人注册
+			err := h.db.Where("user_id = ? AND email <> '' AND email_verified", user.ID).
+				Order("last_login_at desc nulls last").
+				First(&identity).Error
+			if err == nil {
+				email = identity.Email
+			}
+		}
+		if email == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "该用户没有已验证的邮箱地址"})
+			return
+		}
+	}
+
+	token, hash, err := newRefreshToken()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "生成重置链接失败"})
+		return
+	}
+
+	reset := model.PasswordReset{
+		UserID:    user.ID,
+		TokenHash: hash,
+		CreatedBy: c.GetUint("user_id"),
+		ExpiresAt: time.Now().Add(h.ttl),
+	}
+	err = h.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&model.PasswordReset{}).
+			Where("user_id = ? AND used_at IS NULL", user.ID).
+			Update("used_at", time.Now()).Error; err != nil {
+			return err
+		}
+		return tx.Create(&reset).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "生成重置链接失败"})
+		return
+	}
+
+	resetURL := h.publicURL + "/reset-password?token=" + url.QueryEscape(token)
+
+	if req.SendEmail {
+		if err := h.mailer.Send(email, "重置密码", h.resetMailBody(&user, resetURL, reset.ExpiresAt)); err != nil {
+			fmt.Printf("[Mail Error] send password reset to user %d: %v\n", user.ID, err)
+			// 发送失败时作废这个链接，避免留下一个谁都不知道的有效令牌
+			h.db.Model(&reset).Update("used_at", time.Now())
+			c.JSON(http.StatusBadGateway, gin.H{"error": "发送邮件失败"})
+			return
+		}
+
+		recordAudit(h.db, c, "password_reset.created", guard.UserKey(user.Username), "", gin.H{
+			"delivery":   "email",
+			"email":      email,
+			"expires_at": reset.ExpiresAt,
+		})
+		c.JSON(http.StatusCreated, gin.H{"sent": true, "email": email, "expires_at": reset.ExpiresAt})
+		return
+	}
+
+	recordAudit(h.db, c, "password_reset.created", guard.UserKey(user.Username), "", gin.H{
+		"delivery":   "link",
+		"expires_at": reset.ExpiresAt,
+	})
+	c.JSON(http.StatusCreated, gin.H{
+		"sent":       false,
+		"token":      token, // 明文只返回这一次
+		"reset_url":  resetURL,
+		"expires_at": reset.ExpiresAt,
+	})
+}
+
+// ResetPassword 用户凭重置令牌设置新密码，成功后所有会话失效
+func (h *PasswordResetHandler) ResetPassword(c *gin.Context) {
+	var req ResetPasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请求参数错误"})
+		return
+	}
+
+	var reset model.PasswordReset
+	if err := h.db.Where("token_hash = ? AND used_at IS NULL AND expires_at > ?", hashToken(strings.TrimSpace(req.Token)), time.Now()).
+		First(&reset).Error; err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": errInvalidResetToken.Error()})
+		return
+	}
+
+	var user model.User
+	if err := h.db.First(&user, reset.UserID).Error; err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": errInvalidResetToken.Error()})
+		return
+	}
+
+	if err := h.policy.Validate(req.NewPassword, user.Username); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	before := userSnapshot(&user)
+	if err := user.SetPassword(req.NewPassword); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "密码加密失败"})
+		return
+	}
+	// 新密码由用户本人设置，不需要再强制修改
+	user.MustChangePassword = false
+
+	err := h.db.Transaction(func(tx *gorm.DB) error {
+		// 条件更新保证令牌只能使用一次
+		result := tx.Model(&model.PasswordReset{}).
+			Where("id = ? AND used_at IS NULL", reset.ID).
+			Update("used_at", time.Now())
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errInvalidResetToken
+		}
+		if err := tx.Model(&user).Select("password", "must_change_password").Updates(&user).Error; err != nil {
+			return err
+		}
+		return revokeCredentials(tx, user.ID, 0)
+	})
+	if errors.Is(err, errInvalidResetToken) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "重置密码失败"})
+		return
+	}
+
+	disconnectSessions(h.hub, user.ID, 0, "password_reset")
+	// 忘记密码时往往已经被锁定，重置成功后一并解除
+	if err := h.guard.Succeed(user.Username); err != nil {
+		fmt.Printf("[Login Guard Error] %v\n", err)
+	}
+
+	// 用户未登录，审计记录以用户自己为操作人
+	c.Set("user_id", user.ID)
+	c.Set("username", user.Username)
+	recordAuditChange(h.db, c, "password_reset.completed", guard.UserKey(user.Username), before, userSnapshot(&user), nil)
+
+	c.JSON(http.StatusOK, gin.H{"message": "密码已重置，请使用新密码登录"})
+}
+
+func (h *PasswordResetHandler) resetMailBody(user *model.User, resetURL string, expiresAt time.Time) string {
+	return fmt.Sprintf("%s，你好：\n\n管理员为你的账号发起了密码重置。请在 %s 之前打开下面的链接设置新密码：\n\n%s\n\n链接只能使用一次。如果你没有提出过重置请求，请忽略这封邮件并联系管理员。\n",
+		user.Username, expiresAt.Format("2006-01-02 15:04"), resetURL)
+}
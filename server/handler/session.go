@@ -0,0 +1,251 @@
+package handler
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strconv"
+	"talk-web/server/middleware"
+	"talk-web/server/model"
+	"talk-web/server/pkg/ws"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// TokenPair 登录或刷新后返回给客户端的令牌
+type TokenPair struct {
+	Token        string `json:"token"` // 短期访问令牌
+	RefreshToken string `json:"refresh_token"`
+	ExpiresIn    int    `json:"expires_in"` // 访问令牌有效期（秒）
+}
+
+// newRefreshToken 生成随机 refresh token 及其哈希（数据库只保存哈希）
+func newRefreshToken() (string, string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", err
+	}
+	token := hex.EncodeToString(b)
+	return token, hashToken(token), nil
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// issueSession 为用户创建新的登录会话并签发令牌
+func issueSession(db *gorm.DB, c *gin.Context, user *model.User, device string, refreshTTL time.Duration) (*TokenPair, error) {
+	refreshToken, refreshHash, err := newRefreshToken()
+	if err != nil {
+		return nil, fmt.Errorf("generate refresh token failed: %w", err)
+	}
+
+	now := time.Now()
+	session := model.Session{
+		UserID:      user.ID,
+		RefreshHash: refreshHash,
+		Device:      device,
+		IP:          c.ClientIP(),
+		UserAgent:   c.Request.UserAgent(),
+		LastSeenAt:  now,
+		ExpiresAt:   now.Add(refreshTTL),
+	}
+	if err := db.Create(&session).Error; err != nil {
+		return nil, fmt.Errorf("create session failed: %w", err)
+	}
+
+	token, err := middleware.GenerateToken(user, session.ID)
+	if err != nil {
+		return nil, fmt.Errorf("generate token failed: %w", err)
+	}
+
+	return &TokenPair{
+		Token:        token,
+		RefreshToken: refreshToken,
+		ExpiresIn:    int(middleware.AccessTokenTTL().Seconds()),
+	}, nil
+}
+
+// revokeSessions 撤销用户的会话，exceptID 不为 0 时保留该会话
+func revokeSessions(db *gorm.DB, userID uint, exceptID uint) error {
+	query := db.Model(&model.Session{}).Where("user_id = ? AND revoked_at IS NULL", userID)
+	if exceptID != 0 {
+		query = query.Where("id <> ?", exceptID)
+	}
+	return query.Update("revoked_at", time.Now()).Error
+}
+
+// refreshReuseGrace 刚轮换后收到旧 refresh token 视为客户端并发刷新，不当作令牌泄露
+const refreshReuseGrace = 10 * time.Second
+
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token" binding:"required"`
+}
+
+// Refresh 用 refresh token 换取新的访问令牌，refresh token 同时轮换
+func (h *AuthHandler) Refresh(c *gin.Context) {
+	var req RefreshRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请求参数错误"})
+		return
+	}
+
+	refreshHash := hashToken(req.RefreshToken)
+	var session model.Session
+	if err := h.db.Where("refresh_hash = ?", refreshHash).First(&session).Error; err != nil {
+		h.refreshReused(c, refreshHash)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "无效的refresh token"})
+		return
+	}
+	if !session.Active() {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "会话已失效"})
+		return
+	}
+
+	var user model.User
+	if err := h.db.First(&user, session.UserID).Error; err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "用户不存在"})
+		return
+	}
+
+	refreshToken, newHash, err := newRefreshToken()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "生成token失败"})
+		return
+	}
+
+	// 以旧哈希为条件更新，并发刷新时只有一个请求能成功
+	now := time.Now()
+	result := h.db.Model(&model.Session{}).
+		Where("id = ? AND refresh_hash = ?", session.ID, session.RefreshHash).
+		Updates(map[string]interface{}{
+			"refresh_hash":  newHash,
+			"previous_hash": session.RefreshHash,
+			"rotated_at":    now,
+			"last_seen_at":  now,
+			"ip":            c.ClientIP(),
+			"user_agent":    c.Request.UserAgent(),
+		})
+	if result.Error != nil || result.RowsAffected == 0 {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "无效的refresh token"})
+		return
+	}
+
+	token, err := middleware.GenerateToken(&user, session.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "生成token失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, TokenPair{
+		Token:        token,
+		RefreshToken: refreshToken,
+		ExpiresIn:    int(middleware.AccessTokenTTL().Seconds()),
+	})
+}
+
+// refreshReused 已轮换掉的 refresh token 又被使用，说明令牌已被复制：撤销整个会话并断开连接
+func (h *AuthHandler) refreshReused(c *gin.Context, refreshHash string) {
+	var session model.Session
+	if err := h.db.Where("previous_hash = ? AND revoked_at IS NULL", refreshHash).First(&session).Error; err != nil {
+		return
+	}
+	if session.RotatedAt != nil && time.Since(*session.RotatedAt) < refreshReuseGrace {
+		return
+	}
+
+	if err := h.db.Model(&session).Update("revoked_at", time.Now()).Error; err != nil {
+		fmt.Printf("[Session Error] revoke reused session %d failed: %v\n", session.ID, err)
+		return
+	}
+	h.hub.DisconnectSession(session.UserID, session.ID, "session_revoked")
+
+	var user model.User
+	h.db.Select("username").First(&user, session.UserID)
+	recordAudit(h.db, c, "session.refresh_reused", fmt.Sprintf("session:%d", session.ID), user.Username, gin.H{"user_id": session.UserID})
+}
+
+// ListSessions 列出当前用户的有效会话
+func (h *AuthHandler) ListSessions(c *gin.Context) {
+	userID := c.GetUint("user_id")
+	currentID := c.GetUint("session_id")
+
+	var sessions []model.Session
+	err := h.db.Where("user_id = ? AND revoked_at IS NULL AND expires_at > ?", userID, time.Now()).
+		Order("last_seen_at desc").
+		Find(&sessions).Error
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "查询会话失败"})
+		return
+	}
+
+	items := make([]gin.H, 0, len(sessions))
+	for _, s := range sessions {
+		items = append(items, gin.H{
+			"id":           s.ID,
+			"device":       s.Device,
+			"ip":           s.IP,
+			"user_agent":   s.UserAgent,
+			"last_seen_at": s.LastSeenAt,
+			"created_at":   s.CreatedAt,
+			"expires_at":   s.ExpiresAt,
+			"current":      s.ID == currentID,
+		})
+	}
+
+	c.JSON(http.StatusOK, items)
+}
+
+// RevokeSession 撤销当前用户的某个会话
+func (h *AuthHandler) RevokeSession(c *gin.Context) {
+	userID := c.GetUint("user_id")
+
+	result := h.db.Model(&model.Session{}).
+		Where("id = ? AND user_id = ? AND revoked_at IS NULL", c.Param("id"), userID).
+		Update("revoked_at", time.Now())
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "撤销会话失败"})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "会话不存在"})
+		return
+	}
+	if sessionID, err := strconv.ParseUint(c.Param("id"), 10, 64); err == nil {
+		h.hub.DisconnectSession(userID, uint(sessionID), "session_revoked")
+	}
+
+	recordAudit(h.db, c, "session.revoked", "session:"+c.Param("id"), "", nil)
+	c.JSON(http.StatusOK, gin.H{"message": "会话已撤销"})
+}
+
+// revokeCredentials 让用户现有的凭据失效：递增令牌版本、撤销会话和 API key
+// keepSessionID 不为 0 时保留该会话；令牌版本递增后当前访问令牌也会失效，调用方需要为保留的会话重新签发。
+// 应与修改密码、角色等操作在同一个事务中执行，避免改动已生效而旧凭据仍然有效
+func revokeCredentials(tx *gorm.DB, userID, keepSessionID uint) error {
+	err := tx.Model(&model.User{}).Where("id = ?", userID).
+		UpdateColumn("token_version", gorm.Expr("token_version + 1")).Error
+	if err != nil {
+		return err
+	}
+	if err := revokeSessions(tx, userID, keepSessionID); err != nil {
+		return err
+	}
+	// API key 不受令牌版本约束，同样是凭据，一并撤销
+	return tx.Model(&model.APIKey{}).Where("user_id = ? AND revoked_at IS NULL", userID).
+		Update("revoked_at", time.Now()).Error
+}
+
+// disconnectSessions 断开已失效凭据的推送连接，需在事务提交后调用
+func disconnectSessions(hub *ws.Hub, userID, keepSessionID uint, reason string) {
+	if keepSessionID == 0 {
+		hub.DisconnectUser(userID, reason)
+	} else {
+		hub.DisconnectOtherSessions(userID, keepSessionID, reason)
+	}
+}
@@ -0,0 +1,161 @@
+package handler
+
+import (
+	"fmt"
+	"sync"
+	"talk-web/server/pkg/stt"
+	"talk-web/server/pkg/ws"
+)
+
+// streamSession 一次正在进行的流式识别
+type streamSession struct {
+	msgID          string
+	conversationID uint
+	stream         stt.Stream
+}
+
+// StreamHandler 通过 WebSocket 二进制帧进行边录边识别
+//
+// 客户端协议：
+//   - {"type":"start_utterance","msg_id":"...","format":"webm","conversation_id":1} 开始录音
+//   - 二进制帧：音频块（MediaRecorder 按时间片输出）
+//   - {"type":"end_utterance"} 结束录音，生成最终文本并走正常的发送流程
+//   - {"type":"cancel_utterance"} 放弃本次录音
+//
+// 服务端推送 partial_transcript（中间结果）、transcript（最终结果）和 error
+type StreamHandler struct {
+	upload   *UploadHandler
+	streamer stt.StreamingTranscriber
+	hub      *ws.Hub
+
+	mu       sync.Mutex
+	sessions map[*ws.Client]*streamSession
+}
+
+func NewStreamHandler(upload *UploadHandler, streamer stt.StreamingTranscriber, hub *ws.Hub) *StreamHandler {
+	return &StreamHandler{
+		upload:   upload,
+		streamer: streamer,
+		hub:      hub,
+		sessions: make(map[*ws.Client]*streamSession),
+	}
+}
+
+func (h *StreamHandler) HandleText(c *ws.Client, msg *ws.ClientMessage) {
+	switch msg.Type {
+	case "start_utterance":
+		h.start(c, msg)
+	case "end_utterance":
+		if session := h.take(c); session != nil {
+			go h.finish(c, session)
+		}
+	case "cancel_utterance":
+		if session := h.take(c); session != nil {
+			session.stream.Abort()
+		}
+	}
+}
+
+func (h *StreamHandler) HandleBinary(c *ws.Client, data []byte) {
+	h.mu.Lock()
+	session := h.sessions[c]
+	h.mu.Unlock()
+
+	if session == nil {
+		return // 没有进行中的录音，丢弃
+	}
+
+	if err := session.stream.Write(data); err != nil {
+		fmt.Printf("[STT Stream Error] user=%d msg=%s: %v\n", c.UserID, session.msgID, err)
+		if h.take(c) == session {
+			session.stream.Abort()
+		}
+		h.sendError(c, session.msgID, "语音识别失败", err)
+	}
+}
+
+func (h *StreamHandler) Closed(c *ws.Client) {
+	if session := h.take(c); session != nil {
+		session.stream.Abort()
+	}
+}
+
+func (h *StreamHandler) start(c *ws.Client, msg *ws.ClientMessage) {
+	if msg.MsgID == "" {
+		h.sendError(c, "", "缺少 msg_id 参数", nil)
+		return
+	}
+
+	ext := ".webm"
+	if msg.Format != "" {
+		ext = "." + msg.Format
+	}
+
+	msgID := msg.MsgID
+	stream, err := h.streamer.NewStream(ext, func(text string) {
+		h.hub.SendToDevice(c.UserID, c.DeviceID, "partial_transcript", map[string]interface{}{
+			"message_id": msgID,
+			"text":       text,
+		})
+	})
+	if err != nil {
+		h.sendError(c, msgID, "语音识别失败", err)
+		return
+	}
+
+	// 同一连接上开始新的录音时放弃旧的
+	h.mu.Lock()
+	old := h.sessions[c]
+	h.sessions[c] = &streamSession{msgID: msgID, conversationID: msg.ConversationID, stream: stream}
+	h.mu.Unlock()
+
+	if old != nil {
+		old.stream.Abort()
+	}
+}
+
+// take 取出并移除连接上的会话
+func (h *StreamHandler) take(c *ws.Client) *streamSession {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	session := h.sessions[c]
+	delete(h.sessions, c)
+	return session
+}
+
+// finish 生成最终文本并提交消息
+func (h *StreamHandler) finish(c *ws.Client, session *streamSession) {
+	text, err := session.stream.Close()
+	if err != nil {
+		fmt.Printf("[STT Stream Error] user=%d msg=%s: %v\n", c.UserID, session.msgID, err)
+		h.sendError(c, session.msgID, "语音识别失败", err)
+		return
+	}
+
+	fmt.Printf("[STT Stream Success] msg=%s, Text: %s\n", session.msgID, text)
+
+	message, err := h.upload.submit(c.UserID, c.Username, session.msgID, text, session.conversationID)
+	if err != nil {
+		h.sendError(c, session.msgID, "发送消息失败", err)
+		return
+	}
+
+	h.hub.SendToDevice(c.UserID, c.DeviceID, "transcript", map[string]interface{}{
+		"message_id":      message.MessageID,
+		"text":            message.Text,
+		"status":          message.Status,
+		"delivery_status": message.DeliveryStatus,
+	})
+}
+
+func (h *StreamHandler) sendError(c *ws.Client, msgID, errMsg string, err error) {
+	data := map[string]interface{}{
+		"message_id": msgID,
+		"error":      errMsg,
+	}
+	if err != nil {
+		data["detail"] = err.Error()
+	}
+	h.hub.SendToDevice(c.UserID, c.DeviceID, "error", data)
+}
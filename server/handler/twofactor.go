@@ -0,0 +1,380 @@
+package handler
+
+import (
+	"crypto/rand"
+	"encoding/base32"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"talk-web/server/middleware"
+	"talk-web/server/model"
+	"talk-web/server/pkg/guard"
+	"talk-web/server/pkg/totp"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"gorm.io/gorm"
+)
+
+const (
+	challengeTTL       = 5 * time.Minute
+	challengeAudience  = "2fa_challenge" // 与访问令牌区分，挑战令牌不能用于访问接口
+	recoveryCodeCount  = 10
+	recoveryCodeLength = 10
+)
+
+var errInvalidChallenge = errors.New("验证已过期，请重新登录")
+
+// twoFactorChallenge 密码验证通过后签发的挑战令牌
+type twoFactorChallenge struct {
+	UID     uint   `json:"uid"`
+	Version uint   `json:"tv"`
+	Device  string `json:"device,omitempty"`
+	jwt.RegisteredClaims
+}
+
+type TwoFactorLoginRequest struct {
+	ChallengeToken string `json:"challenge_token" binding:"required"`
+	Code           string `json:"code" binding:"required"` // 验证码或恢复码
+}
+
+type TwoFactorSetupRequest struct {
+	Password string `json:"password" binding:"required"`
+}
+
+type TwoFactorCodeRequest struct {
+	Code string `json:"code" binding:"required"`
+}
+
+type TwoFactorDisableRequest struct {
+	Password string `json:"password" binding:"required"`
+	Code     string `json:"code" binding:"required"`
+}
+
+// signChallenge 签发第二步登录需要的挑战令牌（密码登录和单点登录共用）
+func signChallenge(user *model.User, device string) (string, error) {
+	claims := twoFactorChallenge{
+		UID:     user.ID,
+		Version: user.TokenVersion,
+		Device:  device,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Audience:  jwt.ClaimStrings{challengeAudience},
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(challengeTTL)),
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+		},
+	}
+	return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(middleware.GetJWTSecret())
+}
+
+// issueChallenge 返回第二步登录需要的挑战令牌
+func (h *AuthHandler) issueChallenge(c *gin.Context, user *model.User, device string) {
+	token, err := signChallenge(user, device)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "生成token失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"two_factor_required": true,
+		"challenge_token":     token,
+		"expires_in":          int(challengeTTL.Seconds()),
+	})
+}
+
+// LoginTwoFactor 第二步登录：校验挑战令牌和验证码（或恢复码）后签发会话
+func (h *AuthHandler) LoginTwoFactor(c *gin.Context) {
+	var req TwoFactorLoginRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请求参数错误"})
+		return
+	}
+
+	challenge := &twoFactorChallenge{}
+	_, err := jwt.ParseWithClaims(req.ChallengeToken, challenge, func(token *jwt.Token) (interface{}, error) {
+		return middleware.GetJWTSecret(), nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}), jwt.WithAudience(challengeAudience))
+	if err != nil || challenge.UID == 0 {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": errInvalidChallenge.Error()})
+		return
+	}
+
+	var user model.User
+	if err := h.db.First(&user, challenge.UID).Error; err != nil ||
+		user.TokenVersion != challenge.Version || !user.TOTPEnabled {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": errInvalidChallenge.Error()})
+		return
+	}
+
+	// 验证码同样受登录限流保护，防止穷举
+	if !h.checkGuard(c, user.Username) {
+		return
+	}
+
+	method, ok, err := verifySecondFactor(h.db, &user, req.Code)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "校验验证码失败"})
+		return
+	}
+	if !ok {
+		if _, err := h.guard.Fail(user.Username, c.ClientIP()); err != nil {
+			fmt.Printf("[Login Guard Error] %v\n", err)
+		}
+		recordAudit(h.db, c, "login.failed", guard.UserKey(user.Username), user.Username, gin.H{"reason": "wrong_2fa_code"})
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "验证码错误"})
+		return
+	}
+
+	h.completeLogin(c, &user, challenge.Device, method)
+}
+
+// TwoFactorStatus 当前用户的两步验证状态
+func (h *AuthHandler) TwoFactorStatus(c *gin.Context) {
+	var user model.User
+	if err := h.db.First(&user, c.GetUint("user_id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "用户不存在"})
+		return
+	}
+
+	var remaining int64
+	h.db.Model(&model.RecoveryCode{}).Where("user_id = ? AND used_at IS NULL", user.ID).Count(&remaining)
+
+	c.JSON(http.StatusOK, gin.H{
+		"enabled":                  user.TOTPEnabled,
+		"recovery_codes_remaining": remaining,
+	})
+}
+
+// SetupTwoFactor 生成新的 TOTP 密钥，需要再次输入密码
+// 返回的 uri 可显示为二维码供验证器 App 扫描，之后调用 EnableTwoFactor 确认
+func (h *AuthHandler) SetupTwoFactor(c *gin.Context) {
+	var req TwoFactorSetupRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请求参数错误"})
+		return
+	}
+
+	var user model.User
+	if err := h.db.First(&user, c.GetUint("user_id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "用户不存在"})
+		return
+	}
+	if user.TOTPEnabled {
+		c.JSON(http.StatusConflict, gin.H{"error": "已开启两步验证"})
+		return
+	}
+	if !user.CheckPassword(req.Password) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "密码错误"})
+		return
+	}
+
+	secret, err := totp.NewSecret()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "生成密钥失败"})
+		return
+	}
+	if err := h.db.Model(&user).Updates(map[string]interface{}{"totp_secret": secret, "totp_last_step": 0}).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "保存密钥失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"secret": secret,
+		"uri":    totp.URI(h.totpIssuer, user.Username, secret),
+	})
+}
+
+// EnableTwoFactor 用验证器 App 生成的验证码确认绑定，返回一次性恢复码
+func (h *AuthHandler) EnableTwoFactor(c *gin.Context) {
+	var req TwoFactorCodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请求参数错误"})
+		return
+	}
+
+	var user model.User
+	if err := h.db.First(&user, c.GetUint("user_id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "用户不存在"})
+		return
+	}
+	if user.TOTPEnabled {
+		c.JSON(http.StatusConflict, gin.H{"error": "已开启两步验证"})
+		return
+	}
+	if user.TOTPSecret == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请先生成密钥"})
+		return
+	}
+
+	step, ok := totp.Validate(user.TOTPSecret, req.Code, time.Now())
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "验证码错误"})
+		return
+	}
+
+	var codes []string
+	err := h.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&user).Updates(map[string]interface{}{"totp_enabled": true, "totp_last_step": step}).Error; err != nil {
+			return err
+		}
+		var err error
+		codes, err = replaceRecoveryCodes(tx, user.ID)
+		return err
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "开启两步验证失败"})
+		return
+	}
+
+	recordAudit(h.db, c, "2fa.enabled", guard.UserKey(user.Username), "", nil)
+	c.JSON(http.StatusOK, gin.H{"recovery_codes": codes})
+}
+
+// DisableTwoFactor 关闭两步验证，需要密码和验证码（或恢复码）
+func (h *AuthHandler) DisableTwoFactor(c *gin.Context) {
+	var req TwoFactorDisableRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请求参数错误"})
+		return
+	}
+
+	var user model.User
+	if err := h.db.First(&user, c.GetUint("user_id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "用户不存在"})
+		return
+	}
+	if !user.TOTPEnabled {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "未开启两步验证"})
+		return
+	}
+	if !user.CheckPassword(req.Password) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "密码错误"})
+		return
+	}
+	if _, ok, err := verifySecondFactor(h.db, &user, req.Code); err != nil || !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "验证码错误"})
+		return
+	}
+
+	if err := resetTwoFactor(h.db, user.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "关闭两步验证失败"})
+		return
+	}
+
+	recordAudit(h.db, c, "2fa.disabled", guard.UserKey(user.Username), "", nil)
+	c.JSON(http.StatusOK, gin.H{"message": "已关闭两步验证"})
+}
+
+// RegenerateRecoveryCodes 作废旧的恢复码并生成新的一组
+func (h *AuthHandler) RegenerateRecoveryCodes(c *gin.Context) {
+	var req TwoFactorCodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请求参数错误"})
+		return
+	}
+
+	var user model.User
+	if err := h.db.First(&user, c.GetUint("user_id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "用户不存在"})
+		return
+	}
+	if !user.TOTPEnabled {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "未开启两步验证"})
+		return
+	}
+	if _, ok, err := verifySecondFactor(h.db, &user, req.Code); err != nil || !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "验证码错误"})
+		return
+	}
+
+	codes, err := replaceRecoveryCodes(h.db, user.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "生成恢复码失败"})
+		return
+	}
+
+	recordAudit(h.db, c, "2fa.recovery_codes_regenerated", guard.UserKey(user.Username), "", nil)
+	c.JSON(http.StatusOK, gin.H{"recovery_codes": codes})
+}
+
+// verifySecondFactor 校验验证码或恢复码，返回使用的方式
+// 验证码的时间窗口和恢复码都用条件更新标记为已使用，并发请求中只有一个能成功
+func verifySecondFactor(db *gorm.DB, user *model.User, code string) (string, bool, error) {
+	code = strings.TrimSpace(code)
+
+	if len(code) == totp.Digits {
+		step, ok := totp.Validate(user.TOTPSecret, code, time.Now())
+		if !ok || step <= user.TOTPLastStep {
+			return "totp", false, nil
+		}
+		result := db.Model(&model.User{}).
+			Where("id = ? AND totp_last_step < ?", user.ID, step).
+			UpdateColumn("totp_last_step", step)
+		if result.Error != nil {
+			return "totp", false, result.Error
+		}
+		return "totp", result.RowsAffected == 1, nil
+	}
+
+	result := db.Model(&model.RecoveryCode{}).
+		Where("user_id = ? AND code_hash = ? AND used_at IS NULL", user.ID, hashToken(normalizeRecoveryCode(code))).
+		Update("used_at", time.Now())
+	if result.Error != nil {
+		return "recovery_code", false, result.Error
+	}
+	return "recovery_code", result.RowsAffected == 1, nil
+}
+
+// replaceRecoveryCodes 删除用户已有的恢复码并生成新的一组，返回明文（只展示这一次）
+func replaceRecoveryCodes(db *gorm.DB, userID uint) ([]string, error) {
+	if err := db.Where("user_id = ?", userID).Delete(&model.RecoveryCode{}).Error; err != nil {
+		return nil, err
+	}
+
+	codes := make([]string, 0, recoveryCodeCount)
+	rows := make([]model.RecoveryCode, 0, recoveryCodeCount)
+	for i := 0; i < recoveryCodeCount; i++ {
+		code, err := newRecoveryCode()
+		if err != nil {
+			return nil, err
+		}
+		codes = append(codes, code)
+		rows = append(rows, model.RecoveryCode{UserID: userID, CodeHash: hashToken(normalizeRecoveryCode(code))})
+	}
+	if err := db.Create(&rows).Error; err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// resetTwoFactor 清除用户的两步验证设置和恢复码
+func resetTwoFactor(db *gorm.DB, userID uint) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(&model.User{}).Where("id = ?", userID).Updates(map[string]interface{}{
+			"totp_secret":    "",
+			"totp_enabled":   false,
+			"totp_last_step": 0,
+		}).Error
+		if err != nil {
+			return err
+		}
+		return tx.Where("user_id = ?", userID).Delete(&model.RecoveryCode{}).Error
+	})
+}
+
+// newRecoveryCode 生成形如 ABCDE-FGHIJ 的恢复码
+func newRecoveryCode() (string, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	s := base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(b)[:recoveryCodeLength]
+	return s[:recoveryCodeLength/2] + "-" + s[recoveryCodeLength/2:], nil
+}
+
+// normalizeRecoveryCode 忽略大小写、空格和连字符
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToUpper(code)
+	return strings.NewReplacer("-", "", " ", "").Replace(code)
+}
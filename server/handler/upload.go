@@ -1,13 +1,17 @@
 package handler
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"talk-web/server/model"
+	"talk-web/server/pkg/outbox"
 	"talk-web/server/pkg/stt"
 	"talk-web/server/pkg/telegram"
 	"talk-web/server/pkg/tts"
@@ -19,20 +23,20 @@ import (
 )
 
 type UploadHandler struct {
-	stt *stt.STT
-	tts *tts.TTS
-	tg  *telegram.TelegramClient
-	db  *gorm.DB
-	hub *ws.Hub
+	stt    stt.Transcriber
+	tts    tts.Synthesizer
+	db     *gorm.DB
+	hub    *ws.Hub
+	outbox *outbox.Relay
 }
 
-func NewUploadHandler(talkServerURL string, db *gorm.DB, hub *ws.Hub) *UploadHandler {
+func NewUploadHandler(transcriber stt.Transcriber, synthesizer tts.Synthesizer, db *gorm.DB, hub *ws.Hub, relay *outbox.Relay) *UploadHandler {
 	return &UploadHandler{
-		stt: stt.NewSTT(),
-		tts: tts.NewTTS(),
-		tg:  telegram.NewTelegramClient(),
-		db:  db,
-		hub: hub,
+		stt:    transcriber,
+		tts:    synthesizer,
+		db:     db,
+		hub:    hub,
+		outbox: relay,
 	}
 }
 
@@ -48,6 +52,13 @@ func (h *UploadHandler) Upload(c *gin.Context) {
 		return
 	}
 
+	// 先校验参数，避免识别完才发现会话ID无效
+	conversationID, err := parseConversationID(c.PostForm("conversation_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
 	// 接收音频文件
 	file, header, err := c.Request.FormFile("audio")
 	if err != nil {
@@ -90,150 +101,228 @@ func (h *UploadHandler) Upload(c *gin.Context) {
 	// 记录成功的识别
 	fmt.Printf("[STT Success] File: %s, Text: %s\n", tmpFile, recognizedText)
 
-	// 保存到数据库
-	message := model.Message{
-		MessageID: msgID,  // 添加消息ID
-		UserID:    userID,
-		Username:  username,
-		Text:      recognizedText,
-		Status:    "sent",
-		SentAt:    time.Now(),
+	message, err := h.submit(userID, username, msgID, recognizedText, conversationID)
+	if err != nil {
+		respondSubmitError(c, err)
+		return
 	}
-	if err := h.db.Create(&message).Error; err != nil {
-		fmt.Printf("[DB Error] Failed to save message: %v\n", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "保存消息失败"})
+
+	// 立即返回识别结果，不等待回复
+	c.JSON(http.StatusOK, gin.H{
+		"text":            message.Text,
+		"message_id":      message.MessageID, // 返回消息ID
+		"status":          message.Status,
+		"delivery_status": message.DeliveryStatus,
+		"message":         "消息已提交，正在发送...",
+		"user_id":         userID,
+		"username":        username,
+	})
+}
+
+type SendTextRequest struct {
+	MsgID          string `json:"msg_id" binding:"required"`
+	Text           string `json:"text" binding:"required"`
+	ConversationID uint   `json:"conversation_id"`
+}
+
+// SendText 直接发送文字消息（不经过语音识别），后续回复和 TTS 流程与语音相同
+func (h *UploadHandler) SendText(c *gin.Context) {
+	userID := c.GetUint("user_id")
+	username := c.GetString("username")
+
+	var req SendTextRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请求参数错误"})
 		return
 	}
 
-	// 新格式：from-web:[user_id]:[msg_id] 消息内容
-	telegramText := fmt.Sprintf("from-web:%d:%s %s", userID, msgID, recognizedText)
-	fmt.Printf("[Format] Telegram message: %s\n", telegramText)
+	text := strings.TrimSpace(req.Text)
+	if text == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "消息内容不能为空"})
+		return
+	}
 
-	// 发送到 Telegram
-	err = h.tg.SendToTelegram(telegramText, telegram.DefaultBot)
+	message, err := h.submit(userID, username, req.MsgID, text, req.ConversationID)
 	if err != nil {
-		fmt.Printf("[Telegram Error] Failed to send: %v\n", err)
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error":  "发送到 Telegram 失败",
-			"detail": err.Error(),
-		})
+		respondSubmitError(c, err)
 		return
 	}
 
-	fmt.Printf("[Telegram] Message sent: %s\n", telegramText)
-
-	// 立即返回识别结果，不等待回复
 	c.JSON(http.StatusOK, gin.H{
-		"text":       recognizedText,
-		"message_id": msgID,  // 返回消息ID
-		"status":     "sent",
-		"message":    "消息已发送，等待回复中...",
-		"user_id":    userID,
-		"username":   username,
+		"text":            message.Text,
+		"message_id":      message.MessageID,
+		"status":          message.Status,
+		"delivery_status": message.DeliveryStatus,
+		"message":         "消息已提交，正在发送...",
+		"user_id":         userID,
+		"username":        username,
 	})
+}
 
-	// 异步等待回复并生成 TTS
-	go func() {
-		fmt.Printf("[Telegram] Waiting for reply (async)...\n")
+var (
+	errSaveMessage           = errors.New("保存消息失败")
+	errConversationNotFound  = errors.New("会话不存在或已归档")
+	errInvalidConversationID = errors.New("conversation_id 参数无效")
+)
 
-		// 等待 Telegram 回复（60秒超时）
-		replyMsg, err := h.tg.WaitForReply(telegram.DefaultUser, 60*time.Second)
+// submit 保存用户消息，并在同一事务中写入发件箱
+// 发件箱由转发器推送给 bot（失败时重试），投递成功后开始等待回复；
+// 回复由分发器交给 HandleReply 处理，超时由分发器的清扫器处理
+// 语音上传、流式识别等入口在得到文本后都走这里；conversationID 为 0 表示不归入会话
+func (h *UploadHandler) submit(userID uint, username, msgID, text string, conversationID uint) (*model.Message, error) {
+	// 会话决定消息发往哪个 bot
+	bot := telegram.DefaultBot
+	var convID *uint
+	if conversationID != 0 {
+		var conversation model.Conversation
+		err := h.db.Where("id = ? AND user_id = ? AND archived = ?", conversationID, userID, false).
+			First(&conversation).Error
 		if err != nil {
-			fmt.Printf("[Telegram Error] No reply: %v\n", err)
-			// 更新状态为超时
-			h.db.Model(&message).Updates(map[string]interface{}{
-				"status": "timeout",
-			})
-			return
+			return nil, errConversationNotFound
 		}
+		bot = conversation.Bot
+		convID = &conversation.ID
+	}
 
-		replyText := replyMsg.Text
-		fmt.Printf("[Telegram Reply] %s\n", replyText)
+	message := model.Message{
+		MessageID:      msgID, // 添加消息ID
+		UserID:         userID,
+		ConversationID: convID,
+		Username:       username,
+		Text:           text,
+		Status:         "sent",
+		DeliveryStatus: model.DeliveryQueued,
+		SentAt:         time.Now(),
+	}
 
-		// 解析新格式：to-web:[user_id]:[msg_id] 回复内容
-		// 检查是否为 to-web 消息
-		if len(replyText) < 7 || replyText[:7] != "to-web:" {
-			fmt.Printf("[Telegram] 非 to-web 消息，忽略\n")
-			h.db.Model(&message).Update("status", "ignored")
-			return
-		}
+	// 结构化信封（Text 中仍附带 from-web:[user_id]:[msg_id] 旧格式）
+	payload, err := json.Marshal(&telegram.Envelope{
+		Kind:           telegram.KindFromWeb,
+		MessageID:      msgID,
+		UserID:         userID,
+		ConversationID: conversationID,
+		Text:           text,
+		CreatedAt:      message.SentAt,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errSaveMessage, err)
+	}
 
-		// 分割 header 和 content
-		parts := strings.SplitN(replyText, " ", 2)
-		if len(parts) < 2 {
-			fmt.Printf("[Telegram Error] 格式错误，缺少消息内容\n")
-			return
+	// 消息和发件箱记录同时写入，不会出现保存了消息却没有投递的情况
+	err = h.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&message).Error; err != nil {
+			return err
+		}
+		if err := tx.Create(&model.OutboxMessage{
+			MessageID:     msgID,
+			UserID:        userID,
+			Recipient:     bot,
+			Payload:       string(payload),
+			Status:        model.OutboxPending,
+			NextAttemptAt: message.SentAt,
+		}).Error; err != nil {
+			return err
 		}
+		if convID != nil {
+			return tx.Model(&model.Conversation{}).Where("id = ?", *convID).Update("updated_at", message.SentAt).Error
+		}
+		return nil
+	})
+	if err != nil {
+		fmt.Printf("[DB Error] Failed to save message: %v\n", err)
+		return nil, fmt.Errorf("%w: %v", errSaveMessage, err)
+	}
 
-		header := parts[0]      // "to-web:[user_id]:[msg_id]"
-		displayText := parts[1] // "回复内容"
+	h.outbox.Notify()
 
-		// 解析 header
-		headerParts := strings.Split(header, ":")
-		if len(headerParts) != 3 {
-			fmt.Printf("[Telegram Error] Header 格式错误: %s\n", header)
-			return
-		}
+	return &message, nil
+}
 
-		replyUserIDStr := headerParts[1]
-		replyMsgID := headerParts[2]
+// respondSubmitError 把 submit 的错误转换为 HTTP 响应
+func respondSubmitError(c *gin.Context, err error) {
+	if errors.Is(err, errConversationNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": errConversationNotFound.Error()})
+		return
+	}
+	c.JSON(http.StatusInternalServerError, gin.H{"error": errSaveMessage.Error()})
+}
 
-		// 验证 user_id 匹配
-		var replyUserID uint
-		fmt.Sscanf(replyUserIDStr, "%d", &replyUserID)
-		if replyUserID != userID {
-			fmt.Printf("[Telegram Warning] UserID 不匹配: 期望 %d, 实际 %d\n", userID, replyUserID)
-			// 不推送给当前用户
-			return
-		}
+// HandleReply 处理分发器投递的回复：生成 TTS、保存并推送给用户
+// 服务重启前发出的消息和超时后才到的回复也走这里
+func (h *UploadHandler) HandleReply(message model.Message, r *telegram.Envelope) {
+	displayText := r.Text
+	fmt.Printf("[Telegram Reply] %s\n", displayText)
 
-		// 验证 msg_id 匹配
-		if replyMsgID != msgID {
-			fmt.Printf("[Telegram Warning] MessageID 不匹配: 期望 %s, 实际 %s\n", msgID, replyMsgID)
-			// 不推送给当前用户
-			return
-		}
+	// TTS: 文字转语音（使用去掉前缀的文本和用户的语音偏好）
+	replyAudioPath, err := h.tts.Synthesize(displayText, h.voiceFor(message.UserID))
+	audioURL := ""
+	if err != nil {
+		fmt.Printf("[TTS Error] Failed to generate: %v\n", err)
+	} else {
+		audioFilename := filepath.Base(replyAudioPath)
+		audioURL = fmt.Sprintf("/api/audio/%s", audioFilename)
+		fmt.Printf("[TTS Success] Audio generated: %s\n", audioFilename)
+	}
 
-		fmt.Printf("[Telegram] ✓ 验证通过 - UserID: %d, MessageID: %s\n", userID, msgID)
+	// 更新数据库记录（保存去掉前缀的文本）
+	now := time.Now()
+	h.db.Model(&message).Updates(map[string]interface{}{
+		"reply":          displayText,
+		"reply_audio":    audioURL,
+		"status":         "replied",
+		"replied_at":     now,
+		"reply_deadline": nil,
+	})
 
-		// TTS: 文字转语音（使用去掉前缀的文本）
-		replyAudioPath, err := h.tts.Generate(displayText)
-		audioURL := ""
-		if err != nil {
-			fmt.Printf("[TTS Error] Failed to generate: %v\n", err)
-		} else {
-			audioFilename := filepath.Base(replyAudioPath)
-			audioURL = fmt.Sprintf("/api/audio/%s", audioFilename)
-			fmt.Printf("[TTS Success] Audio generated: %s\n", audioFilename)
-		}
+	// 推送到前端（分发器已验证 user_id 和 msg_id 匹配）
+	h.hub.SendToUser(message.UserID, "reply", map[string]interface{}{
+		"message_id":      message.MessageID,
+		"conversation_id": message.ConversationID,
+		"reply":           displayText,
+		"reply_audio":     audioURL,
+	})
+	fmt.Printf("[WebSocket] 推送回复给用户 %d, 消息ID: %s\n", message.UserID, message.MessageID)
+}
 
-		// 更新数据库记录（保存去掉前缀的文本）
-		now := time.Now()
-		h.db.Model(&message).Updates(map[string]interface{}{
-			"reply":       displayText,
-			"reply_audio": audioURL,
-			"status":      "replied",
-			"replied_at":  now,
-		})
+// parseConversationID 解析可选的会话ID参数，未传时返回 0，传了但不是合法 ID 时返回错误
+func parseConversationID(value string) (uint, error) {
+	if value == "" {
+		return 0, nil
+	}
+	id, err := strconv.ParseUint(value, 10, 64)
+	if err != nil || id == 0 {
+		return 0, errInvalidConversationID
+	}
+	return uint(id), nil
+}
 
-		// 推送到前端（已验证 user_id 和 msg_id 匹配）
-		h.hub.SendToUser(userID, "reply", map[string]interface{}{
-			"message_id":  msgID,
-			"reply":       displayText,
-			"reply_audio": audioURL,
-		})
-		fmt.Printf("[WebSocket] 推送回复给用户 %d, 消息ID: %s\n", userID, msgID)
-	}()
+// voiceFor 读取用户的语音偏好
+func (h *UploadHandler) voiceFor(userID uint) tts.SynthesizeOptions {
+	var user model.User
+	if err := h.db.Select("tts_voice", "tts_rate", "tts_pitch").First(&user, userID).Error; err != nil {
+		return tts.SynthesizeOptions{}
+	}
+	return tts.SynthesizeOptions{
+		Voice: user.TTSVoice,
+		Rate:  user.TTSRate,
+		Pitch: user.TTSPitch,
+	}
 }
 
 // GetReply 获取最近发送消息的回复
-// 逻辑：找到最新发送的消息，检查它是否已有回复
+// 逻辑：找到最新发送的消息（可按 conversation_id 限定会话），检查它是否已有回复
 func (h *UploadHandler) GetReply(c *gin.Context) {
 	userID := c.GetUint("user_id")
 
 	// 获取用户最新发送的一条消息（不管状态）
+	query, err := h.scopeMessages(c, userID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
 	var latestMessage model.Message
-	err := h.db.Where("user_id = ?", userID).
+	err = query.
 		Order("sent_at desc").
 		First(&latestMessage).Error
 
@@ -270,26 +359,15 @@ func (h *UploadHandler) GetReply(c *gin.Context) {
 	}
 }
 
-// GetHistory 获取用户的对话历史（最近N条）
-func (h *UploadHandler) GetHistory(c *gin.Context) {
-	userID := c.GetUint("user_id")
-
-	// 获取最近3条消息（按创建时间倒序，最新的在前）
-	var messages []model.Message
-	err := h.db.Where("user_id = ?", userID).
-		Order("created_at desc").
-		Limit(3).
-		Find(&messages).Error
-
+// scopeMessages 当前用户的消息查询，带 conversation_id 参数时只查该会话
+func (h *UploadHandler) scopeMessages(c *gin.Context, userID uint) (*gorm.DB, error) {
+	conversationID, err := parseConversationID(c.Query("conversation_id"))
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error": "获取历史记录失败",
-		})
-		return
+		return nil, err
 	}
-
-	c.JSON(http.StatusOK, gin.H{
-		"messages": messages,
-		"count":    len(messages),
-	})
+	query := h.db.Where("user_id = ?", userID)
+	if conversationID != 0 {
+		query = query.Where("conversation_id = ?", conversationID)
+	}
+	return query, nil
 }
@@ -1,13 +1,17 @@
 package handler
 
 import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
 	"log"
 	"net/http"
+	"strconv"
 	"talk-web/server/middleware"
 	"talk-web/server/pkg/ws"
+	"time"
 
 	"github.com/gin-gonic/gin"
-	"github.com/golang-jwt/jwt/v5"
 	"github.com/gorilla/websocket"
 )
 
@@ -20,12 +24,14 @@ var upgrader = websocket.Upgrader{
 }
 
 type WebSocketHandler struct {
-	hub *ws.Hub
+	hub     *ws.Hub
+	streams *StreamHandler
 }
 
-func NewWebSocketHandler(hub *ws.Hub) *WebSocketHandler {
+func NewWebSocketHandler(hub *ws.Hub, streams *StreamHandler) *WebSocketHandler {
 	return &WebSocketHandler{
-		hub: hub,
+		hub:     hub,
+		streams: streams,
 	}
 }
 
@@ -38,14 +44,15 @@ func (h *WebSocketHandler) ServeWS(c *gin.Context) {
 		return
 	}
 
-	// 验证 token
-	claims := &middleware.Claims{}
-	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
-		return middleware.GetJWTSecret(), nil
-	})
+	// 验证 token（包括会话是否已被撤销）
+	claims, err := middleware.ParseToken(tokenString)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
 
-	if err != nil || !token.Valid {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "无效的token"})
+	if claims.MustChangePassword {
+		c.JSON(http.StatusForbidden, gin.H{"error": "请先修改密码", "code": middleware.CodePasswordChangeRequired})
 		return
 	}
 
@@ -63,12 +70,44 @@ func (h *WebSocketHandler) ServeWS(c *gin.Context) {
 		return
 	}
 
-	client := ws.NewClient(userID, username, h.hub, conn)
+	// 设备标识：前端可以传入固定的 device_id，否则每个连接生成一个
+	deviceID := c.Query("device_id")
+	if deviceID == "" {
+		deviceID = newDeviceID()
+	}
+
+	client := ws.NewClient(userID, username, deviceID, claims.SessionID, h.hub, conn)
+	client.SetHandler(h.streams)
+
+	// 断线重连：补发 last_event_id 之后的事件（由 WritePump 直接写到连接上）
+	if lastEventID := c.Query("last_event_id"); lastEventID != "" {
+		if id, err := strconv.ParseUint(lastEventID, 10, 64); err == nil {
+			client.SetReplay(id)
+		}
+	}
+
+	// 先注册再补发，补发期间的新事件不会丢失
 	h.hub.Register(client)
 
 	// 启动读写协程
 	go client.WritePump()
 	go client.ReadPump()
 
-	log.Printf("WebSocket connected: user=%d (%s)", userID, username)
+	// 告知当前设备自己的标识和同一用户在线的其它设备
+	h.hub.SendToDevice(userID, deviceID, "status", map[string]interface{}{
+		"event":     "connected",
+		"device_id": deviceID,
+		"devices":   h.hub.Devices(userID),
+	})
+
+	log.Printf("WebSocket connected: user=%d (%s) device=%s", userID, username, deviceID)
+}
+
+// newDeviceID 生成随机设备标识
+func newDeviceID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return fmt.Sprintf("dev-%d", time.Now().UnixNano())
+	}
+	return hex.EncodeToString(b)
 }
@@ -1,16 +1,34 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
 	"talk-web/server/config"
 	"talk-web/server/handler"
 	"talk-web/server/middleware"
 	"talk-web/server/model"
+	"talk-web/server/pkg/guard"
+	"talk-web/server/pkg/mail"
+	"talk-web/server/pkg/oidc"
+	"talk-web/server/pkg/outbox"
+	"talk-web/server/pkg/password"
+	"talk-web/server/pkg/reply"
+	"talk-web/server/pkg/stt"
+	"talk-web/server/pkg/telegram"
+	"talk-web/server/pkg/tts"
 	"talk-web/server/pkg/ws"
+	"time"
 
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
 )
@@ -19,6 +37,10 @@ func main() {
 	// 加载配置
 	cfg := config.Load()
 
+	// 收到 SIGINT/SIGTERM 时结束后台任务并优雅关闭服务
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
 	// 连接数据库
 	db, err := gorm.Open(postgres.Open(cfg.DSN()), &gorm.Config{})
 	if err != nil {
@@ -26,34 +48,105 @@ func main() {
 	}
 
 	// 自动迁移
-	if err := db.AutoMigrate(&model.User{}, &model.Message{}); err != nil {
+	if err := db.AutoMigrate(&model.User{}, &model.Message{}, &model.Event{}, &model.Conversation{}, &model.Session{}, &model.AuditEvent{}, &model.APIKey{}, &model.ExternalIdentity{}, &model.RecoveryCode{}, &model.Invite{}, &model.PasswordReset{}, &model.OutboxMessage{}); err != nil {
 		log.Fatal("数据库迁移失败:", err)
 	}
 
-	// 创建默认管理员账号（如果不存在）
+	// 旧版本的 is_admin 迁移为角色
+	if err := model.MigrateRoles(db); err != nil {
+		log.Fatal("迁移用户角色失败:", err)
+	}
+
+	// 历史搜索索引（失败时搜索仍可用，只是没有索引加速）
+	if err := model.CreateSearchIndexes(db); err != nil {
+		log.Println("⚠️ 创建搜索索引失败:", err)
+	}
+
+	// 审计记录只允许追加（失败时仍由 ORM 钩子拒绝修改）
+	if err := model.CreateAuditTriggers(db); err != nil {
+		log.Println("⚠️ 创建审计触发器失败:", err)
+	}
+
+	// 创建默认管理员账号（如果不存在），首次登录后必须修改密码
 	var count int64
 	db.Model(&model.User{}).Count(&count)
 	if count == 0 {
 		admin := model.User{
-			Username: "admin",
-			IsAdmin:  true,
+			Username:           "admin",
+			Role:               model.RoleAdmin,
+			MustChangePassword: true,
 		}
 		admin.SetPassword("admin123")
 		if err := db.Create(&admin).Error; err != nil {
 			log.Fatal("创建默认管理员失败:", err)
 		}
-		log.Println("✓ 已创建默认管理员: admin/admin123")
+		log.Println("✓ 已创建默认管理员 admin，初始密码 admin123，首次登录需修改密码")
+	}
+
+	// 密码策略
+	passwordPolicy := &password.Policy{
+		MinLength:   cfg.PasswordMinLength,
+		MinClasses:  cfg.PasswordMinClasses,
+		CheckCommon: cfg.PasswordCheckCommon,
+	}
+	if cfg.PasswordCommonFile != "" {
+		list, err := password.LoadCommonFile(cfg.PasswordCommonFile)
+		if err != nil {
+			log.Fatal("加载常见密码列表失败:", err)
+		}
+		passwordPolicy.Common = list
+		log.Printf("✓ 已加载 %d 个常见密码", len(list))
 	}
 
-	// 初始化JWT
+	// 初始化JWT（访问令牌校验时会检查会话是否已撤销）
 	middleware.InitJWT(cfg.JWTSecret)
+	middleware.InitAuth(db, cfg.AccessTokenTTL)
+
+	// 登录防爆破：Redis 可用时多实例共享计数，否则退回进程内存
+	var guardStore guard.Store
+	rdb := redis.NewClient(&redis.Options{Addr: cfg.RedisAddr})
+	if err := rdb.Ping(context.Background()).Err(); err != nil {
+		log.Println("⚠️ Redis 不可用，登录限制使用内存存储:", err)
+		rdb.Close()
+		guardStore = guard.NewMemoryStore()
+	} else {
+		guardStore = guard.NewRedisStore(rdb)
+	}
+	userPolicy := guard.DefaultUserPolicy
+	userPolicy.MaxFailures = cfg.LoginMaxFailures
+	userPolicy.Lockout = cfg.LoginLockout
+	ipPolicy := guard.DefaultIPPolicy
+	ipPolicy.MaxFailures = cfg.LoginIPMaxFailures
+	ipPolicy.Lockout = cfg.LoginLockout
+	loginGuard := guard.New(guardStore, userPolicy, ipPolicy)
 
 	// 初始化 WebSocket Hub
-	hub := ws.NewHub()
+	// 事件持久化：离线期间的回复在重连时补发，已确认的事件保留 7 天
+	eventStore := ws.NewDBStore(db)
+	go eventStore.PruneAcked(ctx, 7*24*time.Hour)
+
+	hub := ws.NewHub(eventStore)
 	go hub.Run()
 
-	// 启动 Redis 监听器 (自动把 inbox:AlbertVoiceBot 的消息推送给 WebSocket 客户端)
-	go hub.StartRedisListener("localhost:6379")
+	// Telegram 消息队列与登录限制使用同一个 Redis
+	tgClient := telegram.NewTelegramClientWithConfig(telegram.Config{
+		RedisAddr: cfg.RedisAddr,
+		Recipient: telegram.DefaultBot,
+		Username:  telegram.DefaultUser,
+	})
+
+	// 回复分发器（唯一消费 inbox:AlbertClaudeBot，按 msg_id 路由回复）
+	// 先恢复重启前仍在等待回复的消息，handlers 创建后再开始消费收件箱
+	replies := reply.NewDispatcher(tgClient, db, hub)
+	if err := replies.Recover(); err != nil {
+		log.Println("⚠️  恢复等待回复的消息失败:", err)
+	}
+	go replies.Sweep(ctx)
+
+	// 发件箱转发器：把消息推送到 message_queue，失败时指数退避重试
+	relay := outbox.NewRelay(db, tgClient, hub, replies, outbox.DefaultPolicy)
+	go relay.Run(ctx)
+	go relay.Prune(ctx, 7*24*time.Hour)
 
 	// 创建路由
 	r := gin.Default()
@@ -69,16 +162,91 @@ func main() {
 			"https://home.tail96df5.ts.net",
 		},
 		AllowMethods:     []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-		AllowHeaders:     []string{"Origin", "Content-Type", "Authorization"},
+		AllowHeaders:     []string{"Origin", "Content-Type", "Authorization", "Last-Event-ID", "X-API-Key"},
 		ExposeHeaders:    []string{"Content-Length"},
 		AllowCredentials: true,
 	}))
 
+	// 语音识别后端
+	transcriber, err := stt.New(stt.Options{
+		Backend:    cfg.STTBackend,
+		ScriptPath: cfg.STTScriptPath,
+		Model:      cfg.STTModel,
+		URL:        cfg.STTURL,
+		APIKey:     cfg.STTAPIKey,
+		Language:   cfg.STTLanguage,
+		FFmpegPath: cfg.STTFFmpegPath,
+	})
+	if err != nil {
+		log.Fatal("初始化语音识别失败:", err)
+	}
+
+	// 语音合成后端（音频输出到 /tmp，由 /api/audio 提供下载）
+	synthesizer, err := tts.New(tts.Options{
+		Backend:    cfg.TTSBackend,
+		ScriptPath: cfg.TTSScriptPath,
+		ScriptOpts: cfg.TTSScriptOpts,
+		URL:        cfg.TTSURL,
+		Style:      cfg.TTSStyle,
+		APIKey:     cfg.TTSAPIKey,
+		Model:      cfg.TTSModel,
+		OutputDir:  "/tmp",
+		Voices:     strings.Split(cfg.TTSVoices, ","),
+		Defaults: tts.SynthesizeOptions{
+			Voice:  cfg.TTSVoice,
+			Format: cfg.TTSFormat,
+		},
+	})
+	if err != nil {
+		log.Fatal("初始化语音合成失败:", err)
+	}
+
+	// 单点登录（未配置 OIDC_ISSUER 时不启用）
+	var oidcProvider *oidc.Provider
+	if cfg.OIDCIssuer != "" {
+		oidcProvider, err = oidc.New(oidc.Options{
+			Issuer:       cfg.OIDCIssuer,
+			ClientID:     cfg.OIDCClientID,
+			ClientSecret: cfg.OIDCClientSecret,
+			RedirectURL:  cfg.OIDCRedirectURL,
+			Scopes:       strings.Fields(cfg.OIDCScopes),
+			GroupsClaim:  cfg.OIDCGroupsClaim,
+		})
+		if err != nil {
+			log.Fatal("初始化单点登录失败:", err)
+		}
+		log.Println("✓ 已启用单点登录:", cfg.OIDCIssuer)
+	}
+
+	// 邮件（未配置 SMTP_HOST 时不启用）
+	var mailer *mail.Mailer
+	if cfg.SMTPHost != "" {
+		mailer = mail.New(mail.Options{
+			Host:     cfg.SMTPHost,
+			Port:     cfg.SMTPPort,
+			Username: cfg.SMTPUsername,
+			Password: cfg.SMTPPassword,
+			From:     cfg.SMTPFrom,
+		})
+		log.Printf("✓ 已启用邮件发送: %s:%d", cfg.SMTPHost, cfg.SMTPPort)
+	}
+
 	// 初始化handlers
-	authHandler := handler.NewAuthHandler(db)
-	adminHandler := handler.NewAdminHandler(db)
-	uploadHandler := handler.NewUploadHandler(cfg.TalkServerURL, db, hub)
-	wsHandler := handler.NewWebSocketHandler(hub)
+	authHandler := handler.NewAuthHandler(db, hub, cfg.RefreshTokenTTL, loginGuard, passwordPolicy, cfg.TOTPIssuer, synthesizer.Voices())
+	adminHandler := handler.NewAdminHandler(db, hub, loginGuard, passwordPolicy)
+	inviteHandler := handler.NewInviteHandler(db, loginGuard, passwordPolicy)
+	resetHandler := handler.NewPasswordResetHandler(db, hub, loginGuard, passwordPolicy, mailer, cfg.PasswordResetTTL, cfg.PublicURL)
+	uploadHandler := handler.NewUploadHandler(transcriber, synthesizer, db, hub, relay)
+	replies.SetHandler(uploadHandler)
+	go replies.Run(ctx)
+	// 流式识别：每 2 秒对已收到的音频做一次中间识别
+	streamHandler := handler.NewStreamHandler(uploadHandler, stt.AsStreaming(transcriber, 2*time.Second), hub)
+	wsHandler := handler.NewWebSocketHandler(hub, streamHandler)
+	eventsHandler := handler.NewEventsHandler(hub)
+	conversationHandler := handler.NewConversationHandler(db, strings.Split(cfg.TelegramBots, ","))
+	exportHandler := handler.NewExportHandler(db)
+	apiKeyHandler := handler.NewAPIKeyHandler(db)
+	oidcHandler := handler.NewOIDCHandler(db, oidcProvider, cfg.RefreshTokenTTL, cfg.OIDCAdminGroup, cfg.OIDCAutoProvision, cfg.OIDCTrustIdPMFA)
 
 	// 路由
 	api := r.Group("/api")
@@ -87,37 +255,109 @@ func main() {
 		auth := api.Group("/auth")
 		{
 			auth.POST("/login", authHandler.Login)
-			auth.POST("/logout", authHandler.Logout)
+			auth.POST("/login/2fa", authHandler.LoginTwoFactor)
+			auth.POST("/refresh", authHandler.Refresh)
+			auth.POST("/register", inviteHandler.Register)
+			auth.POST("/password-reset", resetHandler.ResetPassword)
+			// 以下接口在要求修改密码期间仍然可用
+			auth.POST("/logout", middleware.AuthRequired(), authHandler.Logout)
 			auth.GET("/me", middleware.AuthRequired(), authHandler.Me)
-		}
+			auth.POST("/change-password", middleware.AuthRequired(), middleware.SessionRequired(), authHandler.ChangePassword)
 
-		// 上传音频
-		api.POST("/upload", middleware.AuthRequired(), uploadHandler.Upload)
+			// 单点登录（授权码 + PKCE）
+			auth.GET("/oidc/config", oidcHandler.Config)
+			auth.GET("/oidc/login", oidcHandler.Login)
+			auth.GET("/oidc/callback", oidcHandler.Callback)
+		}
 
 		// WebSocket 连接（实时推送，认证在 handler 内部处理）
 		api.GET("/ws", wsHandler.ServeWS)
 
-		// 轮询获取回复（兼容旧版本）
-		api.GET("/reply", middleware.AuthRequired(), uploadHandler.GetReply)
+		// 需要登录且已完成必要的密码修改
+		protected := api.Group("")
+		protected.Use(middleware.AuthRequired(), middleware.PasswordChangeRequired())
+		{
+			// 会话和 API key 管理只能通过登录会话访问
+			credentials := protected.Group("/auth")
+			credentials.Use(middleware.SessionRequired())
+			{
+				credentials.GET("/sessions", authHandler.ListSessions)
+				credentials.DELETE("/sessions/:id", authHandler.RevokeSession)
+				credentials.GET("/api-keys", apiKeyHandler.ListAPIKeys)
+				credentials.POST("/api-keys", apiKeyHandler.CreateAPIKey)
+				credentials.DELETE("/api-keys/:id", apiKeyHandler.RevokeAPIKey)
+				credentials.GET("/2fa", authHandler.TwoFactorStatus)
+				credentials.POST("/2fa/setup", authHandler.SetupTwoFactor)
+				credentials.POST("/2fa/enable", authHandler.EnableTwoFactor)
+				credentials.POST("/2fa/disable", authHandler.DisableTwoFactor)
+				credentials.POST("/2fa/recovery-codes", authHandler.RegenerateRecoveryCodes)
+				credentials.POST("/oidc/link", oidcHandler.Link)
+				credentials.GET("/identities", oidcHandler.ListIdentities)
+				credentials.DELETE("/identities/:id", oidcHandler.UnlinkIdentity)
+			}
+			protected.PUT("/auth/preferences", authHandler.UpdatePreferences)
 
-		// 获取历史记录
-		api.GET("/history", middleware.AuthRequired(), uploadHandler.GetHistory)
+			// 上传音频
+			protected.POST("/upload", uploadHandler.Upload)
 
-		// 下载音频文件
-		api.GET("/audio/:filename", middleware.AuthRequired(), func(c *gin.Context) {
-			filename := c.Param("filename")
-			filePath := fmt.Sprintf("/tmp/%s", filename)
-			c.File(filePath)
-		})
+			// 文字消息（不经过语音识别）
+			protected.POST("/messages", uploadHandler.SendText)
 
-		// 管理后台
-		admin := api.Group("/admin")
-		admin.Use(middleware.AuthRequired(), middleware.AdminRequired())
-		{
-			admin.GET("/users", adminHandler.ListUsers)
-			admin.POST("/users", adminHandler.CreateUser)
-			admin.PUT("/users/:id", adminHandler.UpdateUser)
-			admin.DELETE("/users/:id", adminHandler.DeleteUser)
+			// Server-Sent Events（WebSocket 不可用时的备用推送通道）
+			protected.GET("/events", eventsHandler.Stream)
+			protected.POST("/events/ack", eventsHandler.Ack)
+
+			// 轮询获取回复（兼容旧版本）
+			protected.GET("/reply", uploadHandler.GetReply)
+
+			// 获取历史记录
+			protected.GET("/history", uploadHandler.GetHistory)
+
+			// 导出历史记录
+			protected.GET("/export", exportHandler.Export)
+
+			// 会话
+			conversations := protected.Group("/conversations")
+			{
+				conversations.GET("", conversationHandler.ListConversations)
+				conversations.POST("", conversationHandler.CreateConversation)
+				conversations.GET("/:id", conversationHandler.GetConversation)
+				conversations.PUT("/:id", conversationHandler.UpdateConversation)
+			}
+
+			// 下载音频文件
+			protected.GET("/audio/:filename", func(c *gin.Context) {
+				filename := c.Param("filename")
+				filePath := fmt.Sprintf("/tmp/%s", filename)
+				c.File(filePath)
+			})
+
+			// 管理后台（按权限控制，见 model/role.go）
+			admin := protected.Group("/admin")
+			{
+				admin.POST("/broadcast", middleware.RequirePermission(model.PermBroadcast), adminHandler.Broadcast)
+				admin.GET("/audit-events", middleware.RequirePermission(model.PermAuditView), adminHandler.ListAuditEvents)
+
+				users := admin.Group("")
+				users.Use(middleware.RequirePermission(model.PermUsersManage))
+				{
+					users.GET("/roles", adminHandler.ListRoles)
+					users.GET("/users", adminHandler.ListUsers)
+					users.POST("/users", adminHandler.CreateUser)
+					users.PUT("/users/:id", adminHandler.UpdateUser)
+					users.PUT("/users/:id/role", adminHandler.SetRole)
+					users.DELETE("/users/:id/2fa", adminHandler.ResetTwoFactor)
+					users.POST("/users/:id/password-reset", resetHandler.CreatePasswordReset)
+					users.DELETE("/users/:id", adminHandler.DeleteUser)
+					users.GET("/users/pending", inviteHandler.ListPendingUsers)
+					users.POST("/users/:id/approve", inviteHandler.ApproveUser)
+					users.GET("/invites", inviteHandler.ListInvites)
+					users.POST("/invites", inviteHandler.CreateInvite)
+					users.DELETE("/invites/:id", inviteHandler.RevokeInvite)
+					users.GET("/lockouts", adminHandler.ListLockouts)
+					users.DELETE("/lockouts/:kind/:value", adminHandler.ClearLockout)
+				}
+			}
 		}
 	}
 
@@ -129,7 +369,18 @@ func main() {
 	// 启动服务
 	addr := fmt.Sprintf(":%s", cfg.Port)
 	log.Printf("服务启动在 %s", addr)
-	if err := r.Run(addr); err != nil {
-		log.Fatal("启动服务失败:", err)
+	srv := &http.Server{Addr: addr, Handler: r}
+	go func() {
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatal("启动服务失败:", err)
+		}
+	}()
+
+	<-ctx.Done()
+	log.Println("正在关闭服务...")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		log.Println("关闭服务失败:", err)
 	}
 }
@@ -0,0 +1,126 @@
+package middleware
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"strings"
+	"talk-web/server/model"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// APIKeyPrefix API key 的固定前缀，用于和 JWT 区分
+const APIKeyPrefix = "tk_"
+
+var (
+	ErrInvalidAPIKey   = errors.New("无效的 API key")
+	ErrAPIKeyForbidden = errors.New("API key 权限不足")
+)
+
+// NewAPIKey 生成新的 API key，返回明文、哈希和用于展示的前缀
+func NewAPIKey() (key, hash, prefix string, err error) {
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", "", err
+	}
+	key = APIKeyPrefix + hex.EncodeToString(b)
+	return key, HashAPIKey(key), key[:len(APIKeyPrefix)+6], nil
+}
+
+// HashAPIKey 计算 API key 的哈希
+func HashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// isAPIKey 判断凭证是 API key 还是 JWT
+func isAPIKey(credential string) bool {
+	return strings.HasPrefix(credential, APIKeyPrefix)
+}
+
+// ParseAPIKey 校验 API key 并返回对应的 key 和用户
+func ParseAPIKey(key string) (*model.APIKey, *model.User, error) {
+	if db == nil {
+		return nil, nil, ErrInvalidAPIKey
+	}
+
+	var apiKey model.APIKey
+	if err := db.Where("key_hash = ?", HashAPIKey(key)).First(&apiKey).Error; err != nil {
+		return nil, nil, ErrInvalidAPIKey
+	}
+	if !apiKey.Active() {
+		return nil, nil, ErrInvalidAPIKey
+	}
+
+	var user model.User
+	if err := db.First(&user, apiKey.UserID).Error; err != nil {
+		return nil, nil, ErrInvalidAPIKey // 用户已删除
+	}
+
+	return &apiKey, &user, nil
+}
+
+// touchAPIKey 按间隔记录最后使用时间和来源 IP
+func touchAPIKey(apiKey *model.APIKey, ip string) {
+	if apiKey.LastUsedAt != nil && time.Since(*apiKey.LastUsedAt) <= lastSeenInterval {
+		return
+	}
+	db.Model(apiKey).UpdateColumns(map[string]interface{}{
+		"last_used_at": time.Now(),
+		"last_used_ip": ip,
+	})
+}
+
+// requiredScope 根据请求方法判断需要的权限
+func requiredScope(method string) string {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return model.ScopeRead
+	default:
+		return model.ScopeWrite
+	}
+}
+
+// authenticateAPIKey 用 API key 认证请求并设置上下文，失败时已写入响应
+func authenticateAPIKey(c *gin.Context, key string) bool {
+	apiKey, user, err := ParseAPIKey(key)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		c.Abort()
+		return false
+	}
+	if !apiKey.HasScope(requiredScope(c.Request.Method)) {
+		c.JSON(http.StatusForbidden, gin.H{"error": ErrAPIKeyForbidden.Error()})
+		c.Abort()
+		return false
+	}
+
+	touchAPIKey(apiKey, c.ClientIP())
+
+	c.Set("user_id", user.ID)
+	c.Set("username", user.Username)
+	// key 的权限是角色权限与 key scope 的交集，管理员的 key 也需要显式授予
+	c.Set("is_admin", user.Role == model.RoleAdmin && apiKey.HasScope(model.ScopeAdmin))
+	c.Set("role", user.Role)
+	c.Set("permissions", apiKey.Permissions(user.Role))
+	c.Set("must_change_password", user.MustChangePassword)
+	c.Set("api_key_id", apiKey.ID)
+	return true
+}
+
+// SessionRequired 只允许通过登录会话（JWT）访问，必须在 AuthRequired 之后使用
+// 用于会话管理、API key 管理等敏感接口，泄露的 API key 不能用来创建新的凭证
+func SessionRequired() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.GetUint("session_id") == 0 {
+			c.JSON(http.StatusForbidden, gin.H{"error": "该接口需要登录会话，不能使用 API key"})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
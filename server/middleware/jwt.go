@@ -1,38 +1,80 @@
 package middleware
 
 import (
+	"errors"
 	"net/http"
 	"strings"
+	"talk-web/server/model"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt/v5"
+	"gorm.io/gorm"
 )
 
 type Claims struct {
-	UserID  uint   `json:"user_id"`
+	UserID   uint   `json:"user_id"`
 	Username string `json:"username"`
-	IsAdmin bool   `json:"is_admin"`
+	IsAdmin  bool   `json:"is_admin"`
+	Role     string `json:"role"`
+	// Permissions 签发时角色拥有的权限，仅供客户端展示；服务端校验时按数据库中的角色重新计算
+	Permissions []string `json:"scp,omitempty"`
+	SessionID   uint     `json:"sid,omitempty"`
+	Version     uint     `json:"tv"` // 签发时用户的 TokenVersion
+
+	// 以下字段不写入令牌，由 ParseToken 从数据库读取
+	MustChangePassword bool `json:"-"`
 	jwt.RegisteredClaims
 }
 
-var jwtSecret []byte
+var (
+	jwtSecret      []byte
+	accessTokenTTL = 15 * time.Minute
+	db             *gorm.DB
+)
+
+// lastSeenInterval 会话 last_seen_at 的最小更新间隔，避免每个请求都写库
+const lastSeenInterval = time.Minute
+
+var (
+	ErrInvalidToken   = errors.New("无效的token")
+	ErrSessionRevoked = errors.New("会话已失效")
+	ErrTokenOutdated  = errors.New("登录状态已失效，请重新登录")
+)
 
 func InitJWT(secret string) {
 	jwtSecret = []byte(secret)
 }
 
+// InitAuth 设置令牌校验需要的数据库和访问令牌有效期
+func InitAuth(database *gorm.DB, ttl time.Duration) {
+	db = database
+	if ttl > 0 {
+		accessTokenTTL = ttl
+	}
+}
+
 func GetJWTSecret() []byte {
 	return jwtSecret
 }
 
-func GenerateToken(userID uint, username string, isAdmin bool) (string, error) {
+// AccessTokenTTL 访问令牌有效期
+func AccessTokenTTL() time.Duration {
+	return accessTokenTTL
+}
+
+// GenerateToken 为用户的某个会话签发短期访问令牌
+func GenerateToken(user *model.User, sessionID uint) (string, error) {
 	claims := Claims{
-		UserID:   userID,
-		Username: username,
-		IsAdmin:  isAdmin,
+		UserID:      user.ID,
+		Username:    user.Username,
+		IsAdmin:     user.IsAdmin,
+		Role:        user.Role,
+		Permissions: user.Permissions(),
+		SessionID:   sessionID,
+		Version:     user.TokenVersion,
 		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(24 * time.Hour)),
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(accessTokenTTL)),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
 		},
 	}
@@ -41,8 +83,74 @@ func GenerateToken(userID uint, username string, isAdmin bool) (string, error) {
 	return token.SignedString(jwtSecret)
 }
 
+// ParseToken 校验访问令牌签名、有效期、令牌版本以及所属会话是否仍然有效
+// 校验通过时角色和权限使用数据库中的最新值
+func ParseToken(tokenString string) (*Claims, error) {
+	claims := &Claims{}
+	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		return jwtSecret, nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}))
+	if err != nil || !token.Valid || claims.UserID == 0 {
+		return nil, ErrInvalidToken
+	}
+
+	if db != nil {
+		if claims.SessionID == 0 {
+			return nil, ErrInvalidToken
+		}
+		if err := checkUser(claims); err != nil {
+			return nil, err
+		}
+		if err := touchSession(claims.SessionID, claims.UserID); err != nil {
+			return nil, err
+		}
+	}
+
+	return claims, nil
+}
+
+// checkUser 确认用户仍然存在且令牌版本未变化
+func checkUser(claims *Claims) error {
+	var user model.User
+	if err := db.Select("id", "role", "token_version", "must_change_password").First(&user, claims.UserID).Error; err != nil {
+		return ErrTokenOutdated // 用户已删除
+	}
+	if user.TokenVersion != claims.Version {
+		return ErrTokenOutdated
+	}
+	claims.Role = user.Role
+	claims.IsAdmin = user.Role == model.RoleAdmin
+	claims.Permissions = user.Permissions()
+	claims.MustChangePassword = user.MustChangePassword
+	return nil
+}
+
+// touchSession 确认会话有效，并按间隔刷新最后活跃时间
+func touchSession(sessionID, userID uint) error {
+	var session model.Session
+	if err := db.Where("id = ? AND user_id = ?", sessionID, userID).First(&session).Error; err != nil {
+		return ErrSessionRevoked
+	}
+	if !session.Active() {
+		return ErrSessionRevoked
+	}
+
+	if time.Since(session.LastSeenAt) > lastSeenInterval {
+		db.Model(&session).UpdateColumn("last_seen_at", time.Now())
+	}
+	return nil
+}
+
+// AuthRequired 需要登录，接受 Bearer JWT 或 API key（Bearer tk_... 或 X-API-Key 头）
 func AuthRequired() gin.HandlerFunc {
 	return func(c *gin.Context) {
+		if key := c.GetHeader("X-API-Key"); key != "" {
+			if authenticateAPIKey(c, key) {
+				c.Next()
+			}
+			return
+		}
+
 		authHeader := c.GetHeader("Authorization")
 		if authHeader == "" {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "需要认证"})
@@ -57,13 +165,16 @@ func AuthRequired() gin.HandlerFunc {
 			return
 		}
 
-		claims := &Claims{}
-		token, err := jwt.ParseWithClaims(parts[1], claims, func(token *jwt.Token) (interface{}, error) {
-			return jwtSecret, nil
-		})
+		if isAPIKey(parts[1]) {
+			if authenticateAPIKey(c, parts[1]) {
+				c.Next()
+			}
+			return
+		}
 
-		if err != nil || !token.Valid {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "无效的token"})
+		claims, err := ParseToken(parts[1])
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
 			c.Abort()
 			return
 		}
@@ -71,18 +182,10 @@ func AuthRequired() gin.HandlerFunc {
 		c.Set("user_id", claims.UserID)
 		c.Set("username", claims.Username)
 		c.Set("is_admin", claims.IsAdmin)
-		c.Next()
-	}
-}
-
-func AdminRequired() gin.HandlerFunc {
-	return func(c *gin.Context) {
-		isAdmin, exists := c.Get("is_admin")
-		if !exists || !isAdmin.(bool) {
-			c.JSON(http.StatusForbidden, gin.H{"error": "需要管理员权限"})
-			c.Abort()
-			return
-		}
+		c.Set("role", claims.Role)
+		c.Set("permissions", claims.Permissions)
+		c.Set("session_id", claims.SessionID)
+		c.Set("must_change_password", claims.MustChangePassword)
 		c.Next()
 	}
 }
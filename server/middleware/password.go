@@ -0,0 +1,26 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// CodePasswordChangeRequired 需要先修改密码时返回的错误码，前端据此跳转到改密页面
+const CodePasswordChangeRequired = "password_change_required"
+
+// PasswordChangeRequired 用户被要求修改密码时拒绝请求，必须在 AuthRequired 之后使用
+// 改密、登出、获取当前用户等接口不使用该中间件
+func PasswordChangeRequired() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.GetBool("must_change_password") {
+			c.JSON(http.StatusForbidden, gin.H{
+				"error": "请先修改密码",
+				"code":  CodePasswordChangeRequired,
+			})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,32 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// HasPermission 当前请求是否拥有指定权限，必须在 AuthRequired 之后调用
+func HasPermission(c *gin.Context, perm string) bool {
+	perms, _ := c.Get("permissions")
+	list, _ := perms.([]string)
+	for _, p := range list {
+		if p == perm {
+			return true
+		}
+	}
+	return false
+}
+
+// RequirePermission 需要指定权限，必须在 AuthRequired 之后使用
+// 权限由 AuthRequired 按数据库中的角色计算，角色变更后立即生效
+func RequirePermission(perm string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !HasPermission(c, perm) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "权限不足", "permission": perm})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
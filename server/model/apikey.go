@@ -0,0 +1,57 @@
+package model
+
+import (
+	"time"
+)
+
+// API key 权限范围
+const (
+	ScopeRead  = "read"  // 只读接口（GET）
+	ScopeWrite = "write" // 发送消息、修改数据
+	ScopeAdmin = "admin" // 角色拥有的全部权限
+)
+
+// 除以上 scope 外，也可以授予单项权限（如 conversations:view_all），见 role.go
+
+// APIKey 用户创建的个人 API key，供脚本和自动化使用
+// 明文只在创建时返回一次，数据库保存 SHA-256 哈希
+type APIKey struct {
+	ID         uint       `json:"id" gorm:"primaryKey"`
+	UserID     uint       `json:"user_id" gorm:"not null;index"`
+	Name       string     `json:"name" gorm:"not null"`
+	Prefix     string     `json:"prefix"` // 明文前几位，用于在列表中辨认
+	KeyHash    string     `json:"-" gorm:"not null;uniqueIndex"`
+	Scopes     []string   `json:"scopes" gorm:"serializer:json"`
+	ExpiresAt  *time.Time `json:"expires_at"` // 为空表示永不过期
+	LastUsedAt *time.Time `json:"last_used_at"`
+	LastUsedIP string     `json:"last_used_ip"`
+	RevokedAt  *time.Time `json:"revoked_at"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+// Active 未被撤销且未过期
+func (k *APIKey) Active() bool {
+	return k.RevokedAt == nil && (k.ExpiresAt == nil || time.Now().Before(*k.ExpiresAt))
+}
+
+// Permissions key 在用户当前角色下实际拥有的权限
+// 角色降级后 key 的权限随之收缩
+func (k *APIKey) Permissions(role string) []string {
+	perms := []string{}
+	for _, perm := range RolePermissions(role) {
+		if k.HasScope(ScopeAdmin) || k.HasScope(perm) {
+			perms = append(perms, perm)
+		}
+	}
+	return perms
+}
+
+// HasScope 是否包含指定权限
+func (k *APIKey) HasScope(scope string) bool {
+	for _, s := range k.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
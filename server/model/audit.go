@@ -0,0 +1,55 @@
+package model
+
+import (
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// ErrAuditImmutable 审计记录只能追加
+var ErrAuditImmutable = errors.New("audit events are append-only")
+
+// AuditEvent 审计记录，只追加不修改
+type AuditEvent struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	ActorID   *uint     `json:"actor_id" gorm:"index"` // 未登录的操作（如登录失败）为空
+	ActorName string    `json:"actor_name"`
+	Action    string    `json:"action" gorm:"not null;index"` // 如 login.failed
+	Target    string    `json:"target" gorm:"index"`          // 如 user:alice
+	Changes   string    `json:"changes" gorm:"type:jsonb"`    // 字段变更 {"field": {"from": .., "to": ..}}，敏感字段已脱敏
+	Detail    string    `json:"detail" gorm:"type:jsonb"`
+	IP        string    `json:"ip"`
+	UserAgent string    `json:"user_agent"`
+	CreatedAt time.Time `json:"created_at" gorm:"index"`
+}
+
+// BeforeUpdate 禁止通过 ORM 修改审计记录
+func (e *AuditEvent) BeforeUpdate(tx *gorm.DB) error {
+	return ErrAuditImmutable
+}
+
+// BeforeDelete 禁止通过 ORM 删除审计记录
+func (e *AuditEvent) BeforeDelete(tx *gorm.DB) error {
+	return ErrAuditImmutable
+}
+
+// CreateAuditTriggers 在数据库层面拒绝修改和删除审计记录
+func CreateAuditTriggers(db *gorm.DB) error {
+	statements := []string{
+		`CREATE OR REPLACE FUNCTION audit_events_immutable() RETURNS trigger AS $$
+		BEGIN
+			RAISE EXCEPTION 'audit_events is append-only';
+		END;
+		$$ LANGUAGE plpgsql`,
+		"DROP TRIGGER IF EXISTS audit_events_no_modify ON audit_events",
+		`CREATE TRIGGER audit_events_no_modify BEFORE UPDATE OR DELETE ON audit_events
+		FOR EACH ROW EXECUTE FUNCTION audit_events_immutable()`,
+	}
+	for _, stmt := range statements {
+		if err := db.Exec(stmt).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,16 @@
+package model
+
+import (
+	"time"
+)
+
+// Conversation 对话线程，一个用户可以同时有多个
+type Conversation struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	UserID    uint      `json:"user_id" gorm:"not null;index"`
+	Title     string    `json:"title" gorm:"not null"`
+	Bot       string    `json:"bot" gorm:"not null"` // 绑定的 bot（消息发往该 bot）
+	Archived  bool      `json:"archived" gorm:"not null;default:false"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
@@ -0,0 +1,16 @@
+package model
+
+import (
+	"time"
+)
+
+// Event 推送给用户的 Hub 事件（reply、status 等），用于离线补发
+type Event struct {
+	ID        uint       `json:"-" gorm:"primaryKey"`
+	UserID    uint       `json:"user_id" gorm:"not null;uniqueIndex:idx_event_user_seq"`
+	Seq       uint64     `json:"id" gorm:"not null;uniqueIndex:idx_event_user_seq"` // 每个用户内单调递增
+	Type      string     `json:"type" gorm:"not null"`
+	Data      string     `json:"data" gorm:"type:jsonb"`
+	AckedAt   *time.Time `json:"acked_at"`
+	CreatedAt time.Time  `json:"created_at"`
+}
@@ -0,0 +1,18 @@
+package model
+
+import (
+	"time"
+)
+
+// ExternalIdentity 外部身份提供方（OIDC）账号与本地用户的关联
+type ExternalIdentity struct {
+	ID            uint       `json:"id" gorm:"primaryKey"`
+	UserID        uint       `json:"user_id" gorm:"not null;index"`
+	Issuer        string     `json:"issuer" gorm:"not null;uniqueIndex:idx_identity_issuer_subject"`
+	Subject       string     `json:"subject" gorm:"not null;uniqueIndex:idx_identity_issuer_subject"`
+	Email         string     `json:"email"`
+	EmailVerified bool       `json:"email_verified"` // 身份提供方确认过的邮箱才会用于发送重置链接
+	Provisioned   bool       `json:"provisioned"`    // 用户是首次登录时自动创建的，角色由身份提供方的用户组决定
+	LastLoginAt   *time.Time `json:"last_login_at"`
+	CreatedAt     time.Time  `json:"created_at"`
+}
@@ -0,0 +1,27 @@
+package model
+
+import (
+	"time"
+)
+
+// Invite 管理员生成的注册邀请码，可限制使用次数和有效期
+// 明文只在创建时返回一次，数据库保存 SHA-256 哈希
+type Invite struct {
+	ID              uint       `json:"id" gorm:"primaryKey"`
+	Prefix          string     `json:"prefix"` // 明文前几位，用于在列表中辨认
+	CodeHash        string     `json:"-" gorm:"not null;uniqueIndex"`
+	Role            string     `json:"role" gorm:"not null;default:user"` // 注册用户获得的角色
+	MaxUses         int        `json:"max_uses" gorm:"not null;default:1"`
+	Uses            int        `json:"uses" gorm:"not null;default:0"`
+	RequireApproval bool       `json:"require_approval" gorm:"not null;default:false"` // 注册后需管理员审核才能登录
+	Note            string     `json:"note"`
+	CreatedBy       uint       `json:"created_by"`
+	ExpiresAt       time.Time  `json:"expires_at" gorm:"not null"`
+	RevokedAt       *time.Time `json:"revoked_at"`
+	CreatedAt       time.Time  `json:"created_at"`
+}
+
+// Active 未被撤销、未过期且还有剩余次数
+func (i *Invite) Active() bool {
+	return i.RevokedAt == nil && time.Now().Before(i.ExpiresAt) && i.Uses < i.MaxUses
+}
@@ -5,16 +5,19 @@ import (
 )
 
 type Message struct {
-	ID         uint       `json:"id" gorm:"primaryKey"`
-	MessageID  string     `json:"message_id" gorm:"uniqueIndex"` // 唯一消息ID（用于精确匹配回复）
-	UserID     uint       `json:"user_id" gorm:"not null;index"`
-	Username   string     `json:"username" gorm:"not null"`
-	Text       string     `json:"text" gorm:"not null"` // 用户说的话（STT识别结果）
-	Reply      string     `json:"reply"`                 // AI回复的内容
-	ReplyAudio string     `json:"reply_audio"`           // TTS 生成的音频文件 URL
-	Status     string     `json:"status" gorm:"not null;default:'sent'"` // sent, replied, timeout
-	SentAt     time.Time  `json:"sent_at" gorm:"not null"`
-	RepliedAt  *time.Time `json:"replied_at"`
-	CreatedAt  time.Time  `json:"created_at"`
-	UpdatedAt  time.Time  `json:"updated_at"`
+	ID             uint       `json:"id" gorm:"primaryKey"`
+	MessageID      string     `json:"message_id" gorm:"uniqueIndex"` // 唯一消息ID（用于精确匹配回复）
+	UserID         uint       `json:"user_id" gorm:"not null;index"`
+	ConversationID *uint      `json:"conversation_id" gorm:"index"` // 所属会话（为空表示未归入会话）
+	Username       string     `json:"username" gorm:"not null"`
+	Text           string     `json:"text" gorm:"not null"`                                // 用户说的话（STT识别结果）
+	Reply          string     `json:"reply"`                                               // AI回复的内容
+	ReplyAudio     string     `json:"reply_audio"`                                         // TTS 生成的音频文件 URL
+	Status         string     `json:"status" gorm:"not null;default:'sent'"`               // sent, replied, timeout, failed
+	DeliveryStatus string     `json:"delivery_status" gorm:"not null;default:'delivered'"` // queued, delivered, failed，见 outbox.go
+	SentAt         time.Time  `json:"sent_at" gorm:"not null"`
+	ReplyDeadline  *time.Time `json:"reply_deadline" gorm:"index"` // 等待回复的截止时间，收到回复或超时后清空
+	RepliedAt      *time.Time `json:"replied_at"`
+	CreatedAt      time.Time  `json:"created_at"`
+	UpdatedAt      time.Time  `json:"updated_at"`
 }
@@ -0,0 +1,36 @@
+package model
+
+import (
+	"time"
+)
+
+// 消息投递状态（Message.DeliveryStatus）
+const (
+	DeliveryQueued    = "queued"    // 已写入发件箱，等待转发
+	DeliveryDelivered = "delivered" // 已推送到 message_queue
+	DeliveryFailed    = "failed"    // 重试次数用尽，放弃投递
+)
+
+// 发件箱记录状态
+const (
+	OutboxPending   = "pending"
+	OutboxDelivered = "delivered"
+	OutboxFailed    = "failed"
+)
+
+// OutboxMessage 待转发给 bot 的消息
+// 与 Message 在同一个事务中写入，由转发器推送到 Redis，失败时按指数退避重试
+type OutboxMessage struct {
+	ID            uint       `json:"id" gorm:"primaryKey"`
+	MessageID     string     `json:"message_id" gorm:"not null;index"` // 对应 Message.MessageID
+	UserID        uint       `json:"user_id" gorm:"not null"`
+	Recipient     string     `json:"recipient" gorm:"not null"`          // 目标 bot
+	Payload       string     `json:"payload" gorm:"type:jsonb;not null"` // 序列化后的信封
+	Status        string     `json:"status" gorm:"not null;default:'pending'"`
+	Attempts      int        `json:"attempts" gorm:"not null;default:0"`
+	NextAttemptAt time.Time  `json:"next_attempt_at" gorm:"not null;index"`
+	LastError     string     `json:"last_error"`
+	DeliveredAt   *time.Time `json:"delivered_at"`
+	CreatedAt     time.Time  `json:"created_at"`
+	UpdatedAt     time.Time  `json:"updated_at"`
+}
@@ -0,0 +1,14 @@
+package model
+
+import (
+	"time"
+)
+
+// RecoveryCode 两步验证的恢复码，每个只能使用一次，数据库只保存 SHA-256 哈希
+type RecoveryCode struct {
+	ID        uint       `json:"id" gorm:"primaryKey"`
+	UserID    uint       `json:"user_id" gorm:"not null;index"`
+	CodeHash  string     `json:"-" gorm:"not null;uniqueIndex"`
+	UsedAt    *time.Time `json:"used_at"`
+	CreatedAt time.Time  `json:"created_at"`
+}
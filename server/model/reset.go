@@ -0,0 +1,17 @@
+package model
+
+import (
+	"time"
+)
+
+// PasswordReset 管理员为用户生成的一次性重置密码令牌
+// 明文只发给用户一次，数据库保存 SHA-256 哈希
+type PasswordReset struct {
+	ID        uint       `json:"id" gorm:"primaryKey"`
+	UserID    uint       `json:"user_id" gorm:"not null;index"`
+	TokenHash string     `json:"-" gorm:"not null;uniqueIndex"`
+	CreatedBy uint       `json:"created_by"`
+	ExpiresAt time.Time  `json:"expires_at" gorm:"not null"`
+	UsedAt    *time.Time `json:"used_at"`
+	CreatedAt time.Time  `json:"created_at"`
+}
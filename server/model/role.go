@@ -0,0 +1,78 @@
+package model
+
+import (
+	"gorm.io/gorm"
+)
+
+// 角色
+const (
+	RoleUser     = "user"     // 普通用户：只能访问自己的数据
+	RoleOperator = "operator" // 运营：可以查看其他用户的会话、发送广播
+	RoleAdmin    = "admin"    // 管理员：拥有全部权限，可以管理用户
+)
+
+// 权限，同时作为 JWT 和 API key 中的 scope
+const (
+	PermConversationsViewAll = "conversations:view_all" // 查看所有用户的会话和消息
+	PermBroadcast            = "broadcast"              // 向所有在线用户广播
+	PermUsersManage          = "users:manage"           // 管理用户、角色和登录锁定
+	PermAuditView            = "audit:view"             // 查询审计记录
+)
+
+// rolePermissions 每个角色拥有的权限
+var rolePermissions = map[string][]string{
+	RoleUser:     {},
+	RoleOperator: {PermConversationsViewAll, PermBroadcast},
+	RoleAdmin:    {PermConversationsViewAll, PermBroadcast, PermUsersManage, PermAuditView},
+}
+
+// Roles 所有角色，按权限从低到高排列
+var Roles = []string{RoleUser, RoleOperator, RoleAdmin}
+
+// ValidRole 是否为已定义的角色
+func ValidRole(role string) bool {
+	_, ok := rolePermissions[role]
+	return ok
+}
+
+// RolePermissions 返回角色拥有的权限，未知角色没有任何权限
+func RolePermissions(role string) []string {
+	return append([]string(nil), rolePermissions[role]...)
+}
+
+// ValidPermission 是否为已定义的权限
+func ValidPermission(perm string) bool {
+	for _, p := range rolePermissions[RoleAdmin] {
+		if p == perm {
+			return true
+		}
+	}
+	return false
+}
+
+// RoleHasPermission 角色是否拥有指定权限
+func RoleHasPermission(role, perm string) bool {
+	for _, p := range rolePermissions[role] {
+		if p == perm {
+			return true
+		}
+	}
+	return false
+}
+
+// RoleRank 角色的级别，用于判断是否降权
+func RoleRank(role string) int {
+	for i, r := range Roles {
+		if r == role {
+			return i
+		}
+	}
+	return -1
+}
+
+// MigrateRoles 把旧版本的 is_admin 标记迁移为 admin 角色
+func MigrateRoles(db *gorm.DB) error {
+	return db.Model(&User{}).
+		Where("is_admin = ? AND role = ?", true, RoleUser).
+		UpdateColumn("role", RoleAdmin).Error
+}
@@ -0,0 +1,21 @@
+package model
+
+import (
+	"gorm.io/gorm"
+)
+
+// CreateSearchIndexes 为历史消息搜索创建 pg_trgm 索引
+// 三元组索引不依赖分词，对中文同样有效；创建扩展需要相应的数据库权限
+func CreateSearchIndexes(db *gorm.DB) error {
+	statements := []string{
+		"CREATE EXTENSION IF NOT EXISTS pg_trgm",
+		"CREATE INDEX IF NOT EXISTS idx_messages_text_trgm ON messages USING gin (text gin_trgm_ops)",
+		"CREATE INDEX IF NOT EXISTS idx_messages_reply_trgm ON messages USING gin (reply gin_trgm_ops)",
+	}
+	for _, stmt := range statements {
+		if err := db.Exec(stmt).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,27 @@
+package model
+
+import (
+	"time"
+)
+
+// Session 登录会话，每次登录一条，保存轮换中的 refresh token 哈希
+type Session struct {
+	ID           uint       `json:"id" gorm:"primaryKey"`
+	UserID       uint       `json:"user_id" gorm:"not null;index"`
+	RefreshHash  string     `json:"-" gorm:"not null;uniqueIndex"` // 当前 refresh token 的 SHA-256
+	PreviousHash string     `json:"-" gorm:"index"`                // 上一个 refresh token，再次出现说明令牌被复制，整个会话作废
+	RotatedAt    *time.Time `json:"-"`                             // 最近一次轮换时间
+	Device       string     `json:"device"`
+	IP           string     `json:"ip"`
+	UserAgent    string     `json:"user_agent"`
+	LastSeenAt   time.Time  `json:"last_seen_at"`
+	ExpiresAt    time.Time  `json:"expires_at" gorm:"not null"`
+	RevokedAt    *time.Time `json:"revoked_at"`
+	CreatedAt    time.Time  `json:"created_at"`
+	UpdatedAt    time.Time  `json:"updated_at"`
+}
+
+// Active 会话未被撤销且未过期
+func (s *Session) Active() bool {
+	return s.RevokedAt == nil && time.Now().Before(s.ExpiresAt)
+}
@@ -8,15 +8,53 @@ import (
 )
 
 type User struct {
-	ID        uint           `gorm:"primaryKey" json:"id"`
-	Username  string         `gorm:"unique;not null" json:"username"`
-	Password  string         `gorm:"not null" json:"-"`
-	IsAdmin   bool           `gorm:"default:false" json:"is_admin"`
+	ID       uint   `gorm:"primaryKey" json:"id"`
+	Username string `gorm:"unique;not null" json:"username"`
+	Password string `gorm:"not null" json:"-"`
+	IsAdmin  bool   `gorm:"default:false" json:"is_admin"` // 由 Role 派生，保留给旧客户端
+
+	// 角色，决定用户拥有的权限，见 role.go
+	Role string `gorm:"not null;default:user" json:"role"`
+
+	// 首次登录或管理员设置密码后必须先修改密码
+	MustChangePassword bool `gorm:"not null;default:false" json:"must_change_password"`
+
+	// 通过邀请码自助注册的用户，邀请要求审核时在管理员批准前不能登录
+	PendingApproval bool  `gorm:"not null;default:false;index" json:"pending_approval"`
+	InviteID        *uint `json:"invite_id,omitempty"`
+
+	// 两步验证（TOTP）：TOTPSecret 在开始绑定时生成，验证通过后 TOTPEnabled 才为 true
+	TOTPSecret   string `json:"-"`
+	TOTPEnabled  bool   `gorm:"not null;default:false" json:"totp_enabled"`
+	TOTPLastStep int64  `gorm:"not null;default:0" json:"-"` // 最近一次使用的时间窗口，防止验证码重放
+
+	// 令牌版本：改密码、降权、删除时递增，旧令牌随即失效
+	TokenVersion uint `gorm:"not null;default:0" json:"-"`
+
+	// 语音偏好（空值使用服务端默认配置）
+	TTSVoice string  `json:"tts_voice"`
+	TTSRate  float64 `gorm:"default:0" json:"tts_rate"`
+	TTSPitch string  `json:"tts_pitch"`
+
 	CreatedAt time.Time      `json:"created_at"`
 	UpdatedAt time.Time      `json:"updated_at"`
 	DeletedAt gorm.DeletedAt `gorm:"index" json:"-"`
 }
 
+// BeforeSave 保持 IsAdmin 与角色一致
+func (u *User) BeforeSave(tx *gorm.DB) error {
+	if u.Role == "" {
+		u.Role = RoleUser
+	}
+	u.IsAdmin = u.Role == RoleAdmin
+	return nil
+}
+
+// Permissions 用户角色拥有的权限
+func (u *User) Permissions() []string {
+	return RolePermissions(u.Role)
+}
+
 func (u *User) SetPassword(password string) error {
 	hashed, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
 	if err != nil {
@@ -26,6 +64,14 @@ func (u *User) SetPassword(password string) error {
 	return nil
 }
 
+// dummyPasswordHash 用户不存在时用来比较的固定哈希
+var dummyPasswordHash, _ = bcrypt.GenerateFromPassword([]byte("talk-web-dummy-password"), bcrypt.DefaultCost)
+
+// CheckDummyPassword 用户不存在时同样执行一次 bcrypt，避免通过响应时间判断用户名是否存在
+func CheckDummyPassword(password string) {
+	bcrypt.CompareHashAndPassword(dummyPasswordHash, []byte(password))
+}
+
 func (u *User) CheckPassword(password string) bool {
 	err := bcrypt.CompareHashAndPassword([]byte(u.Password), []byte(password))
 	return err == nil
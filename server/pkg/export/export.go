@@ -0,0 +1,238 @@
+package export
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"talk-web/server/model"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	FormatJSON     = "json"
+	FormatMarkdown = "markdown"
+	FormatZip      = "zip"
+)
+
+// Options 导出范围
+type Options struct {
+	UserID         uint
+	ConversationID uint   // 为 0 时导出该用户全部消息
+	AudioDir       string // 回复音频所在目录（ReplyAudio 中只保存了文件名）
+}
+
+// Exporter 流式导出历史消息，逐行读取数据库，不会把全部记录载入内存
+type Exporter struct {
+	db   *gorm.DB
+	opts Options
+}
+
+func New(db *gorm.DB, opts Options) *Exporter {
+	if opts.AudioDir == "" {
+		opts.AudioDir = "/tmp"
+	}
+	return &Exporter{db: db, opts: opts}
+}
+
+// ContentType 返回格式对应的 MIME 类型和文件扩展名
+func ContentType(format string) (string, string, error) {
+	switch format {
+	case FormatJSON:
+		return "application/json", ".json", nil
+	case FormatMarkdown:
+		return "text/markdown; charset=utf-8", ".md", nil
+	case FormatZip:
+		return "application/zip", ".zip", nil
+	default:
+		return "", "", fmt.Errorf("unsupported export format: %s", format)
+	}
+}
+
+// Write 按格式写出
+func (e *Exporter) Write(w io.Writer, format string) error {
+	switch format {
+	case FormatJSON:
+		return e.WriteJSON(w)
+	case FormatMarkdown:
+		return e.WriteMarkdown(w)
+	case FormatZip:
+		return e.WriteZip(w)
+	default:
+		return fmt.Errorf("unsupported export format: %s", format)
+	}
+}
+
+// each 按 ID 升序逐条遍历消息
+func (e *Exporter) each(fn func(m *model.Message) error) error {
+	query := e.db.Model(&model.Message{}).Where("user_id = ?", e.opts.UserID)
+	if e.opts.ConversationID != 0 {
+		query = query.Where("conversation_id = ?", e.opts.ConversationID)
+	}
+
+	rows, err := query.Order("id asc").Rows()
+	if err != nil {
+		return fmt.Errorf("query messages failed: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var m model.Message
+		if err := e.db.ScanRows(rows, &m); err != nil {
+			return fmt.Errorf("scan message failed: %w", err)
+		}
+		if err := fn(&m); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// title 导出标题：会话标题或用户名
+func (e *Exporter) title() string {
+	if e.opts.ConversationID != 0 {
+		var conversation model.Conversation
+		if err := e.db.First(&conversation, e.opts.ConversationID).Error; err == nil {
+			return conversation.Title
+		}
+	}
+	var user model.User
+	if err := e.db.First(&user, e.opts.UserID).Error; err == nil {
+		return user.Username + " 的对话记录"
+	}
+	return "对话记录"
+}
+
+// WriteJSON 导出为 JSON：{"title":..., "exported_at":..., "messages":[...]}
+func (e *Exporter) WriteJSON(w io.Writer) error {
+	header, err := json.Marshal(map[string]interface{}{
+		"title":           e.title(),
+		"user_id":         e.opts.UserID,
+		"conversation_id": e.opts.ConversationID,
+		"exported_at":     time.Now(),
+	})
+	if err != nil {
+		return err
+	}
+
+	// 去掉结尾的 }，接着逐条写 messages 数组
+	if _, err := fmt.Fprintf(w, `%s,"messages":[`, header[:len(header)-1]); err != nil {
+		return err
+	}
+
+	first := true
+	err = e.each(func(m *model.Message) error {
+		data, err := json.Marshal(m)
+		if err != nil {
+			return err
+		}
+		if !first {
+			if _, err := io.WriteString(w, ","); err != nil {
+				return err
+			}
+		}
+		first = false
+		_, err = w.Write(data)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = io.WriteString(w, "]}\n")
+	return err
+}
+
+// WriteMarkdown 导出为 Markdown 对话稿
+func (e *Exporter) WriteMarkdown(w io.Writer) error {
+	if _, err := fmt.Fprintf(w, "# %s\n\n导出时间: %s\n\n", e.title(), time.Now().Format("2006-01-02 15:04:05")); err != nil {
+		return err
+	}
+
+	return e.each(func(m *model.Message) error {
+		var b strings.Builder
+		fmt.Fprintf(&b, "## %s\n\n", m.SentAt.Format("2006-01-02 15:04:05"))
+		fmt.Fprintf(&b, "**你**: %s\n\n", m.Text)
+		if m.Reply != "" {
+			fmt.Fprintf(&b, "**AI**: %s\n\n", m.Reply)
+			if name := audioName(m.ReplyAudio); name != "" {
+				fmt.Fprintf(&b, "🔊 [audio/%s](audio/%s)\n\n", name, name)
+			}
+		} else {
+			fmt.Fprintf(&b, "_（%s）_\n\n", m.Status)
+		}
+		_, err := io.WriteString(w, b.String())
+		return err
+	})
+}
+
+// WriteZip 导出为 ZIP：transcript.md、messages.json 和 audio/ 下的回复音频
+func (e *Exporter) WriteZip(w io.Writer) error {
+	zw := zip.NewWriter(w)
+
+	f, err := zw.Create("transcript.md")
+	if err != nil {
+		return err
+	}
+	if err := e.WriteMarkdown(f); err != nil {
+		return err
+	}
+
+	f, err = zw.Create("messages.json")
+	if err != nil {
+		return err
+	}
+	if err := e.WriteJSON(f); err != nil {
+		return err
+	}
+
+	seen := make(map[string]bool)
+	err = e.each(func(m *model.Message) error {
+		name := audioName(m.ReplyAudio)
+		if name == "" || seen[name] {
+			return nil
+		}
+		seen[name] = true
+		return e.addAudio(zw, name)
+	})
+	if err != nil {
+		return err
+	}
+
+	return zw.Close()
+}
+
+// addAudio 把音频文件写入 ZIP，文件已被清理时跳过
+func (e *Exporter) addAudio(zw *zip.Writer, name string) error {
+	src, err := os.Open(filepath.Join(e.opts.AudioDir, name))
+	if err != nil {
+		fmt.Printf("[Export] 跳过音频 %s: %v\n", name, err)
+		return nil
+	}
+	defer src.Close()
+
+	// 音频已经是压缩格式，直接存储
+	dst, err := zw.CreateHeader(&zip.FileHeader{
+		Name:     "audio/" + name,
+		Method:   zip.Store,
+		Modified: time.Now(),
+	})
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(dst, src)
+	return err
+}
+
+// audioName 从 /api/audio/<文件名> 中取出文件名
+func audioName(url string) string {
+	if url == "" {
+		return ""
+	}
+	return filepath.Base(url)
+}
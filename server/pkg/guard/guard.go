@@ -0,0 +1,189 @@
+package guard
+
+import (
+	"fmt"
+	"time"
+)
+
+// Policy 单个维度（用户名或 IP）的限制策略
+type Policy struct {
+	MaxFailures int           // 连续失败达到该次数后锁定
+	Lockout     time.Duration // 锁定时长
+	BaseDelay   time.Duration // 第一次失败后的等待时间，之后每次翻倍
+	MaxDelay    time.Duration // 单次等待上限
+	Window      time.Duration // 超过该时间没有失败则清零
+}
+
+// State 某个 key 的失败记录
+type State struct {
+	Key         string    `json:"key"`
+	Failures    int       `json:"failures"`
+	LastFailure time.Time `json:"last_failure"`
+	LockedUntil time.Time `json:"locked_until"`
+}
+
+// Store 失败记录存储
+// Fail 必须是原子的读-改-写，否则并发的失败请求会互相覆盖计数，绕过退避和锁定
+type Store interface {
+	Get(key string) (*State, error)
+	Fail(key string, rule Policy, now time.Time) (*State, error)
+	Delete(key string) error
+	List() ([]*State, error)
+}
+
+// LoginGuard 登录防爆破：按用户名和 IP 分别计数，失败后指数退避，超过次数锁定
+type LoginGuard struct {
+	store    Store
+	userRule Policy
+	ipRule   Policy
+}
+
+// DefaultUserPolicy 用户名维度：5 次失败锁定 15 分钟
+var DefaultUserPolicy = Policy{
+	MaxFailures: 5,
+	Lockout:     15 * time.Minute,
+	BaseDelay:   time.Second,
+	MaxDelay:    30 * time.Second,
+	Window:      15 * time.Minute,
+}
+
+// DefaultIPPolicy IP 维度：同一出口可能有多人，阈值更宽松
+var DefaultIPPolicy = Policy{
+	MaxFailures: 20,
+	Lockout:     15 * time.Minute,
+	BaseDelay:   time.Second,
+	MaxDelay:    10 * time.Second,
+	Window:      15 * time.Minute,
+}
+
+func New(store Store, userRule, ipRule Policy) *LoginGuard {
+	return &LoginGuard{
+		store:    store,
+		userRule: userRule,
+		ipRule:   ipRule,
+	}
+}
+
+func UserKey(username string) string { return "user:" + username }
+func IPKey(ip string) string         { return "ip:" + ip }
+
+// Check 返回还需要等待多久才能再次尝试，0 表示允许
+func (g *LoginGuard) Check(username, ip string) (time.Duration, error) {
+	userWait, err := g.wait(UserKey(username), g.userRule)
+	if err != nil {
+		return 0, err
+	}
+	ipWait, err := g.wait(IPKey(ip), g.ipRule)
+	if err != nil {
+		return 0, err
+	}
+	if ipWait > userWait {
+		return ipWait, nil
+	}
+	return userWait, nil
+}
+
+// Fail 记录一次失败，返回用户名维度是否因此被锁定
+func (g *LoginGuard) Fail(username, ip string) (bool, error) {
+	locked, err := g.fail(UserKey(username), g.userRule)
+	if err != nil {
+		return false, err
+	}
+	if _, err := g.fail(IPKey(ip), g.ipRule); err != nil {
+		return locked, err
+	}
+	return locked, nil
+}
+
+// CheckIP 只按 IP 维度检查，用于没有可信用户名的接口（如注册）
+func (g *LoginGuard) CheckIP(ip string) (time.Duration, error) {
+	return g.wait(IPKey(ip), g.ipRule)
+}
+
+// FailIP 只记录 IP 维度的失败，不影响任何用户名的登录
+func (g *LoginGuard) FailIP(ip string) error {
+	_, err := g.fail(IPKey(ip), g.ipRule)
+	return err
+}
+
+// Succeed 登录成功后清除用户名维度的记录（IP 维度自然过期）
+func (g *LoginGuard) Succeed(username string) error {
+	return g.store.Delete(UserKey(username))
+}
+
+// Clear 清除指定 key 的记录（管理员解锁）
+func (g *LoginGuard) Clear(key string) error {
+	return g.store.Delete(key)
+}
+
+// List 列出当前所有失败记录
+func (g *LoginGuard) List() ([]*State, error) {
+	return g.store.List()
+}
+
+func (g *LoginGuard) wait(key string, rule Policy) (time.Duration, error) {
+	state, err := g.store.Get(key)
+	if err != nil || state == nil {
+		return 0, err
+	}
+
+	now := time.Now()
+	if now.Before(state.LockedUntil) {
+		return state.LockedUntil.Sub(now), nil
+	}
+
+	if next := state.LastFailure.Add(rule.backoff(state.Failures)); now.Before(next) {
+		return next.Sub(now), nil
+	}
+	return 0, nil
+}
+
+// backoff 第 failures 次失败后需要等待 BaseDelay * 2^(failures-1)，不超过 MaxDelay
+// Redis 中缺失或损坏的计数会读成 0，按第一次失败处理，避免负数移位
+func (rule Policy) backoff(failures int) time.Duration {
+	if failures < 1 {
+		failures = 1
+	}
+	delay := rule.BaseDelay << (failures - 1)
+	if delay > rule.MaxDelay || delay <= 0 {
+		delay = rule.MaxDelay
+	}
+	return delay
+}
+
+func (g *LoginGuard) fail(key string, rule Policy) (bool, error) {
+	now := time.Now()
+	state, err := g.store.Fail(key, rule, now)
+	if err != nil {
+		return false, fmt.Errorf("save login guard state failed: %w", err)
+	}
+	// 以原子递增后的结果判断是否锁定
+	return now.Before(state.LockedUntil), nil
+}
+
+// advance 在已有记录上累加一次失败，store 在持有锁（或 Lua 脚本内）时调用
+// state 为 nil 表示没有记录；Redis 脚本实现了同样的逻辑，见 redis.go
+func advance(state *State, key string, rule Policy, now time.Time) *State {
+	if state == nil || now.Sub(state.LastFailure) > rule.Window {
+		state = &State{Key: key}
+	}
+	// 锁定结束后重新计数
+	if !state.LockedUntil.IsZero() && !now.Before(state.LockedUntil) {
+		state = &State{Key: key}
+	}
+
+	state.Failures++
+	state.LastFailure = now
+	if state.Failures >= rule.MaxFailures {
+		state.LockedUntil = now.Add(rule.Lockout)
+	}
+	return state
+}
+
+// ttl 记录的保留时间
+func (rule Policy) ttl() time.Duration {
+	if rule.Lockout > rule.Window {
+		return rule.Lockout
+	}
+	return rule.Window
+}
@@ -0,0 +1,199 @@
+package guard
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+// testPolicy 用分钟级的延迟，测试运行时间带来的误差可以忽略
+var testPolicy = Policy{
+	MaxFailures: 4,
+	Lockout:     time.Hour,
+	BaseDelay:   time.Minute,
+	MaxDelay:    3 * time.Minute,
+	Window:      30 * time.Minute,
+}
+
+func TestLoginGuardBackoff(t *testing.T) {
+	tests := []struct {
+		name       string
+		failures   int
+		wantWait   time.Duration
+		wantLocked bool
+	}{
+		{name: "no failures", failures: 0, wantWait: 0},
+		{name: "first failure", failures: 1, wantWait: time.Minute},
+		{name: "doubles", failures: 2, wantWait: 2 * time.Minute},
+		{name: "capped at max delay", failures: 3, wantWait: 3 * time.Minute},
+		{name: "locked at max failures", failures: 4, wantWait: time.Hour, wantLocked: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// IP 维度不设限制，只看用户名维度
+			g := New(NewMemoryStore(), testPolicy, Policy{MaxFailures: 1000, Window: time.Hour})
+
+			var locked bool
+			for i := 0; i < tt.failures; i++ {
+				var err error
+				if locked, err = g.Fail("alice", "10.0.0.1"); err != nil {
+					t.Fatalf("Fail: %v", err)
+				}
+			}
+			if locked != tt.wantLocked {
+				t.Errorf("locked = %v, want %v", locked, tt.wantLocked)
+			}
+
+			wait, err := g.Check("alice", "10.0.0.1")
+			if err != nil {
+				t.Fatalf("Check: %v", err)
+			}
+			if wait > tt.wantWait || wait < tt.wantWait-time.Second {
+				t.Errorf("wait = %v, want about %v", wait, tt.wantWait)
+			}
+
+			if other, _ := g.Check("bob", "10.0.0.2"); other != 0 {
+				t.Errorf("unrelated user wait = %v, want 0", other)
+			}
+		})
+	}
+}
+
+func TestLoginGuardSucceedClears(t *testing.T) {
+	g := New(NewMemoryStore(), testPolicy, Policy{MaxFailures: 1000, Window: time.Hour})
+	for i := 0; i < testPolicy.MaxFailures; i++ {
+		g.Fail("alice", "10.0.0.1")
+	}
+	if err := g.Succeed("alice"); err != nil {
+		t.Fatalf("Succeed: %v", err)
+	}
+	if wait, _ := g.Check("alice", "10.0.0.1"); wait != 0 {
+		t.Errorf("wait after success = %v, want 0", wait)
+	}
+}
+
+// 注册等接口只记 IP 维度，不能借此锁定别人的用户名
+func TestLoginGuardFailIP(t *testing.T) {
+	g := New(NewMemoryStore(), Policy{MaxFailures: 1000, Window: time.Hour}, testPolicy)
+	if err := g.FailIP("10.0.0.1"); err != nil {
+		t.Fatalf("FailIP: %v", err)
+	}
+
+	if wait, _ := g.CheckIP("10.0.0.1"); wait > time.Minute || wait < time.Minute-time.Second {
+		t.Errorf("ip wait = %v, want about %v", wait, time.Minute)
+	}
+	if wait, _ := g.Check("alice", "10.0.0.2"); wait != 0 {
+		t.Errorf("user wait from another ip = %v, want 0", wait)
+	}
+}
+
+func TestAdvance(t *testing.T) {
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name         string
+		state        *State
+		wantFailures int
+		wantLocked   bool
+	}{
+		{name: "first failure", state: nil, wantFailures: 1},
+		{name: "increments", state: &State{Failures: 1, LastFailure: now.Add(-time.Minute)}, wantFailures: 2},
+		{name: "locks at max", state: &State{Failures: 3, LastFailure: now.Add(-time.Minute)}, wantFailures: 4, wantLocked: true},
+		{
+			name:         "stays locked while locked",
+			state:        &State{Failures: 4, LastFailure: now.Add(-time.Minute), LockedUntil: now.Add(time.Minute)},
+			wantFailures: 5,
+			wantLocked:   true,
+		},
+		{name: "resets after window", state: &State{Failures: 3, LastFailure: now.Add(-testPolicy.Window - time.Second)}, wantFailures: 1},
+		{
+			name:         "resets after lockout expires",
+			state:        &State{Failures: 4, LastFailure: now.Add(-time.Minute), LockedUntil: now},
+			wantFailures: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := advance(tt.state, "user:alice", testPolicy, now)
+			if got.Failures != tt.wantFailures {
+				t.Errorf("Failures = %d, want %d", got.Failures, tt.wantFailures)
+			}
+			if !got.LastFailure.Equal(now) {
+				t.Errorf("LastFailure = %v, want %v", got.LastFailure, now)
+			}
+			if locked := now.Before(got.LockedUntil); locked != tt.wantLocked {
+				t.Errorf("locked = %v, want %v", locked, tt.wantLocked)
+			}
+			if tt.wantLocked && !got.LockedUntil.Equal(now.Add(testPolicy.Lockout)) {
+				t.Errorf("LockedUntil = %v, want %v", got.LockedUntil, now.Add(testPolicy.Lockout))
+			}
+		})
+	}
+}
+
+// 并发的失败请求不能丢失计数，否则可以绕过锁定
+func TestMemoryStoreConcurrentFail(t *testing.T) {
+	const workers = 200
+
+	store := NewMemoryStore()
+	g := New(store, testPolicy, Policy{MaxFailures: 1000, Window: time.Hour})
+
+	var (
+		wg     sync.WaitGroup
+		mu     sync.Mutex
+		locked int
+	)
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ok, err := g.Fail("alice", "10.0.0.1")
+			if err != nil {
+				t.Errorf("Fail: %v", err)
+				return
+			}
+			if ok {
+				mu.Lock()
+				locked++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	for key, want := range map[string]int{UserKey("alice"): workers, IPKey("10.0.0.1"): workers} {
+		state, err := store.Get(key)
+		if err != nil || state == nil {
+			t.Fatalf("Get(%s) = %v, %v", key, state, err)
+		}
+		if state.Failures != want {
+			t.Errorf("%s failures = %d, want %d", key, state.Failures, want)
+		}
+	}
+	// 第 MaxFailures 次及之后的请求都应该看到锁定
+	if want := workers - testPolicy.MaxFailures + 1; locked != want {
+		t.Errorf("locked results = %d, want %d", locked, want)
+	}
+}
+
+func TestPolicyBackoff(t *testing.T) {
+	tests := []struct {
+		failures int
+		want     time.Duration
+	}{
+		{failures: -1, want: time.Minute},
+		{failures: 0, want: time.Minute},
+		{failures: 1, want: time.Minute},
+		{failures: 2, want: 2 * time.Minute},
+		{failures: 3, want: 3 * time.Minute},
+		{failures: 100, want: 3 * time.Minute},
+	}
+
+	for _, tt := range tests {
+		if got := testPolicy.backoff(tt.failures); got != tt.want {
+			t.Errorf("backoff(%d) = %v, want %v", tt.failures, got, tt.want)
+		}
+	}
+}
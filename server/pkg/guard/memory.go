@@ -0,0 +1,84 @@
+package guard
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// MemoryStore 进程内存储，Redis 不可用时使用（重启后清零）
+type MemoryStore struct {
+	mu      sync.Mutex
+	entries map[string]memoryEntry
+}
+
+type memoryEntry struct {
+	state    State
+	expireAt time.Time
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{entries: make(map[string]memoryEntry)}
+}
+
+func (s *MemoryStore) Get(key string) (*State, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	state := s.get(key, time.Now())
+	if state == nil {
+		return nil, nil
+	}
+	copied := *state
+	return &copied, nil
+}
+
+// Fail 整个读-改-写都持有锁
+func (s *MemoryStore) Fail(key string, rule Policy, now time.Time) (*State, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	state := advance(s.get(key, now), key, rule, now)
+	s.entries[key] = memoryEntry{state: *state, expireAt: now.Add(rule.ttl())}
+	copied := *state
+	return &copied, nil
+}
+
+// get 读取未过期的记录，调用方需持有锁
+func (s *MemoryStore) get(key string, now time.Time) *State {
+	entry, ok := s.entries[key]
+	if !ok {
+		return nil
+	}
+	if now.After(entry.expireAt) {
+		delete(s.entries, key)
+		return nil
+	}
+	return &entry.state
+}
+
+func (s *MemoryStore) Delete(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.entries, key)
+	return nil
+}
+
+func (s *MemoryStore) List() ([]*State, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	states := make([]*State, 0, len(s.entries))
+	for key, entry := range s.entries {
+		if now.After(entry.expireAt) {
+			delete(s.entries, key)
+			continue
+		}
+		state := entry.state
+		states = append(states, &state)
+	}
+	sort.Slice(states, func(i, j int) bool { return states[i].Key < states[j].Key })
+	return states, nil
+}
@@ -0,0 +1,120 @@
+package guard
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// 记录保存为 hash（failures / last_failure / locked_until，时间为毫秒时间戳）
+const redisPrefix = "login_guard:"
+
+// failScript 原子地累加一次失败，逻辑与 advance 一致
+// 返回 {failures, last_failure, locked_until}
+var failScript = redis.NewScript(`
+local now = tonumber(ARGV[1])
+local window = tonumber(ARGV[2])
+local max = tonumber(ARGV[3])
+local lockout = tonumber(ARGV[4])
+local ttl = tonumber(ARGV[5])
+
+local failures = tonumber(redis.call('HGET', KEYS[1], 'failures') or '0')
+local last = tonumber(redis.call('HGET', KEYS[1], 'last_failure') or '0')
+local locked = tonumber(redis.call('HGET', KEYS[1], 'locked_until') or '0')
+
+if failures == 0 or now - last > window or (locked > 0 and now >= locked) then
+	failures = 0
+	locked = 0
+end
+
+failures = failures + 1
+if failures >= max then
+	locked = now + lockout
+end
+
+redis.call('HSET', KEYS[1], 'failures', failures, 'last_failure', now, 'locked_until', locked)
+redis.call('PEXPIRE', KEYS[1], ttl)
+return {failures, now, locked}
+`)
+
+// RedisStore 基于 Redis 的存储，多实例共享且重启不丢失
+type RedisStore struct {
+	rdb *redis.Client
+	ctx context.Context
+}
+
+func NewRedisStore(rdb *redis.Client) *RedisStore {
+	return &RedisStore{rdb: rdb, ctx: context.Background()}
+}
+
+func (s *RedisStore) Get(key string) (*State, error) {
+	fields, err := s.rdb.HGetAll(s.ctx, redisPrefix+key).Result()
+	if err != nil {
+		return nil, fmt.Errorf("get from redis failed: %w", err)
+	}
+	if len(fields) == 0 {
+		return nil, nil
+	}
+
+	failures, _ := strconv.Atoi(fields["failures"])
+	last, _ := strconv.ParseInt(fields["last_failure"], 10, 64)
+	locked, _ := strconv.ParseInt(fields["locked_until"], 10, 64)
+	return newState(key, int64(failures), last, locked), nil
+}
+
+// Fail 通过 Lua 脚本原子执行读-改-写
+func (s *RedisStore) Fail(key string, rule Policy, now time.Time) (*State, error) {
+	result, err := failScript.Run(s.ctx, s.rdb, []string{redisPrefix + key},
+		now.UnixMilli(),
+		rule.Window.Milliseconds(),
+		rule.MaxFailures,
+		rule.Lockout.Milliseconds(),
+		rule.ttl().Milliseconds(),
+	).Int64Slice()
+	if err != nil {
+		return nil, fmt.Errorf("redis fail script failed: %w", err)
+	}
+	if len(result) != 3 {
+		return nil, fmt.Errorf("redis fail script returned %d values", len(result))
+	}
+	return newState(key, result[0], result[1], result[2]), nil
+}
+
+func (s *RedisStore) Delete(key string) error {
+	return s.rdb.Del(s.ctx, redisPrefix+key).Err()
+}
+
+func (s *RedisStore) List() ([]*State, error) {
+	var states []*State
+	iter := s.rdb.Scan(s.ctx, 0, redisPrefix+"*", 100).Iterator()
+	for iter.Next(s.ctx) {
+		state, err := s.Get(strings.TrimPrefix(iter.Val(), redisPrefix))
+		if err != nil {
+			return nil, err
+		}
+		if state != nil {
+			states = append(states, state)
+		}
+	}
+	if err := iter.Err(); err != nil {
+		return nil, fmt.Errorf("scan redis failed: %w", err)
+	}
+	sort.Slice(states, func(i, j int) bool { return states[i].Key < states[j].Key })
+	return states, nil
+}
+
+func newState(key string, failures, lastMillis, lockedMillis int64) *State {
+	state := &State{Key: key, Failures: int(failures)}
+	if lastMillis > 0 {
+		state.LastFailure = time.UnixMilli(lastMillis)
+	}
+	if lockedMillis > 0 {
+		state.LockedUntil = time.UnixMilli(lockedMillis)
+	}
+	return state
+}
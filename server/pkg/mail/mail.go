@@ -0,0 +1,83 @@
+package mail
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"mime"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"strings"
+	"time"
+)
+
+// Options SMTP 服务器配置
+// 本地测试可以用 MailHog / Mailpit 之类的邮件捕获工具（如 localhost:1025，无需认证）
+type Options struct {
+	Host     string
+	Port     int
+	Username string // 为空时不认证
+	Password string
+	From     string // 发件人，如 "Talk <noreply@example.com>"
+}
+
+// Mailer 通过 SMTP 发送纯文本邮件
+// 服务器支持 STARTTLS 时自动加密；使用认证时标准库要求加密连接（localhost 除外）
+type Mailer struct {
+	opts Options
+}
+
+func New(opts Options) *Mailer {
+	return &Mailer{opts: opts}
+}
+
+// Enabled 是否配置了 SMTP 服务器，nil 表示未启用
+func (m *Mailer) Enabled() bool {
+	return m != nil && m.opts.Host != ""
+}
+
+// Send 发送一封纯文本邮件
+func (m *Mailer) Send(to, subject, body string) error {
+	if !m.Enabled() {
+		return errors.New("mail: smtp not configured")
+	}
+
+	from, err := mail.ParseAddress(m.opts.From)
+	if err != nil {
+		return fmt.Errorf("mail: invalid from address: %w", err)
+	}
+	rcpt, err := mail.ParseAddress(to)
+	if err != nil {
+		return fmt.Errorf("mail: invalid recipient: %w", err)
+	}
+	if strings.ContainsAny(subject, "\r\n") {
+		return errors.New("mail: invalid subject")
+	}
+
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: %s\r\n", from.String())
+	fmt.Fprintf(&msg, "To: %s\r\n", rcpt.String())
+	fmt.Fprintf(&msg, "Subject: %s\r\n", mime.BEncoding.Encode("UTF-8", subject))
+	fmt.Fprintf(&msg, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	msg.WriteString("MIME-Version: 1.0\r\n")
+	msg.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+	msg.WriteString("Content-Transfer-Encoding: base64\r\n\r\n")
+
+	// base64 每行 76 个字符
+	encoded := base64.StdEncoding.EncodeToString([]byte(body))
+	for len(encoded) > 76 {
+		msg.WriteString(encoded[:76] + "\r\n")
+		encoded = encoded[76:]
+	}
+	msg.WriteString(encoded + "\r\n")
+
+	var auth smtp.Auth
+	if m.opts.Username != "" {
+		auth = smtp.PlainAuth("", m.opts.Username, m.opts.Password, m.opts.Host)
+	}
+
+	addr := net.JoinHostPort(m.opts.Host, fmt.Sprint(m.opts.Port))
+	return smtp.SendMail(addr, auth, from.Address, []string{rcpt.Address}, msg.Bytes())
+}
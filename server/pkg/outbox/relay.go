@@ -0,0 +1,301 @@
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"talk-web/server/model"
+	"talk-web/server/pkg/reply"
+	"talk-web/server/pkg/telegram"
+	"talk-web/server/pkg/ws"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Policy 重试策略
+type Policy struct {
+	MaxAttempts  int           // 超过后放弃投递
+	BaseDelay    time.Duration // 第一次重试的等待时间，之后每次翻倍
+	MaxDelay     time.Duration // 单次等待上限
+	PollInterval time.Duration // 没有被唤醒时检查发件箱的间隔
+}
+
+// DefaultPolicy 大约 6 分钟内尝试 10 次
+var DefaultPolicy = Policy{
+	MaxAttempts:  10,
+	BaseDelay:    time.Second,
+	MaxDelay:     2 * time.Minute,
+	PollInterval: 5 * time.Second,
+}
+
+// errEmpty 发件箱中没有到期的记录
+var errEmpty = errors.New("outbox: nothing due")
+
+// Relay 发件箱转发器
+// 把发件箱中的消息推送到 message_queue，投递成功后登记等待回复
+// 推送成功但结果没能写回数据库时会重复投递，消息带有 idempotency_key（即 message_id），bot 端据此去重
+type Relay struct {
+	db      *gorm.DB
+	tg      *telegram.TelegramClient
+	hub     *ws.Hub
+	replies *reply.Dispatcher
+	policy  Policy
+	wake    chan struct{}
+}
+
+func NewRelay(db *gorm.DB, tg *telegram.TelegramClient, hub *ws.Hub, replies *reply.Dispatcher, policy Policy) *Relay {
+	return &Relay{
+		db:      db,
+		tg:      tg,
+		hub:     hub,
+		replies: replies,
+		policy:  policy,
+		wake:    make(chan struct{}, 1),
+	}
+}
+
+// Notify 有新消息写入发件箱，唤醒转发器立即处理
+func (r *Relay) Notify() {
+	select {
+	case r.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Run 持续处理发件箱，直到 ctx 结束
+// 服务重启后未投递的记录仍在发件箱中，会继续处理
+func (r *Relay) Run(ctx context.Context) {
+	fmt.Printf("[Outbox] 开始转发发件箱\n")
+
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-r.wake:
+		case <-timer.C:
+		}
+
+		// 处理所有到期的记录
+		for ctx.Err() == nil {
+			if err := r.relayOne(); err != nil {
+				if !errors.Is(err, errEmpty) {
+					fmt.Printf("[Outbox Error] %v\n", err)
+				}
+				break
+			}
+		}
+
+		if !timer.Stop() {
+			select {
+			case <-timer.C:
+			default:
+			}
+		}
+		timer.Reset(r.nextWait())
+	}
+}
+
+// Prune 定期删除已投递超过 retention 的记录，直到 ctx 结束
+func (r *Relay) Prune(ctx context.Context, retention time.Duration) {
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		cutoff := time.Now().Add(-retention)
+		if err := r.db.Where("status = ? AND delivered_at < ?", model.OutboxDelivered, cutoff).
+			Delete(&model.OutboxMessage{}).Error; err != nil {
+			fmt.Printf("[Outbox Error] prune failed: %v\n", err)
+		}
+	}
+}
+
+// nextWait 距离下一条记录到期的时间，不超过 PollInterval
+func (r *Relay) nextWait() time.Duration {
+	var next model.OutboxMessage
+	err := r.db.Select("next_attempt_at").
+		Where("status = ?", model.OutboxPending).
+		Order("next_attempt_at").
+		First(&next).Error
+	if err != nil {
+		return r.policy.PollInterval
+	}
+
+	wait := time.Until(next.NextAttemptAt)
+	if wait < 0 {
+		wait = 0
+	}
+	if wait > r.policy.PollInterval {
+		wait = r.policy.PollInterval
+	}
+	return wait
+}
+
+// relayOne 认领一条到期的记录并尝试投递
+// 推送在事务之外进行，不会在等待 Redis 时一直持有行锁和数据库连接
+func (r *Relay) relayOne() error {
+	item, err := r.claim()
+	if err != nil {
+		return err
+	}
+
+	notify, err := r.deliver(item)
+	if err != nil {
+		return err
+	}
+
+	// 状态写入数据库后再通知客户端
+	if notify != nil {
+		notify()
+	}
+	return nil
+}
+
+// claim 取出一条到期的记录，计入一次尝试并把下次尝试时间推后后立即提交
+// 行锁加 SKIP LOCKED，多个实例同时运行时不会重复认领同一条；
+// 认领后进程崩溃的记录会在退避时间过后被重新认领
+func (r *Relay) claim() (*model.OutboxMessage, error) {
+	var item model.OutboxMessage
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("status = ? AND next_attempt_at <= ?", model.OutboxPending, time.Now()).
+			Order("next_attempt_at").
+			First(&item).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return errEmpty
+		}
+		if err != nil {
+			return err
+		}
+
+		item.Attempts++
+		item.NextAttemptAt = time.Now().Add(r.policy.backoff(item.Attempts))
+		return tx.Model(&item).Updates(map[string]interface{}{
+			"attempts":        item.Attempts,
+			"next_attempt_at": item.NextAttemptAt,
+		}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &item, nil
+}
+
+// deliver 推送已认领的记录并写回结果
+func (r *Relay) deliver(item *model.OutboxMessage) (func(), error) {
+	var env telegram.Envelope
+	if err := json.Unmarshal([]byte(item.Payload), &env); err != nil {
+		// 数据损坏，重试也没用
+		return r.fail(item, fmt.Errorf("decode payload failed: %w", err))
+	}
+
+	// 先登记再推送，避免回复先于登记到达
+	deadline := time.Now().Add(reply.Timeout)
+	r.replies.Track(item.MessageID, item.UserID, deadline)
+
+	if sendErr := r.tg.SendEnvelope(&env, item.Recipient); sendErr != nil {
+		r.replies.Forget(item.MessageID)
+		if item.Attempts >= r.policy.MaxAttempts {
+			return r.fail(item, sendErr)
+		}
+		return nil, r.retry(item, sendErr)
+	}
+
+	return r.delivered(item, deadline)
+}
+
+// delivered 标记投递成功，消息开始计算回复超时
+// 写入失败时记录仍是待投递状态，退避后会再推送一次，bot 端按 idempotency_key 去重
+func (r *Relay) delivered(item *model.OutboxMessage, deadline time.Time) (func(), error) {
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(item).Updates(map[string]interface{}{
+			"status":       model.OutboxDelivered,
+			"delivered_at": time.Now(),
+			"last_error":   "",
+		}).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&model.Message{}).Where("message_id = ?", item.MessageID).
+			Update("delivery_status", model.DeliveryDelivered).Error; err != nil {
+			return err
+		}
+		// 回复可能在写入前就已到达并处理，此时不再写入截止时间
+		return tx.Model(&model.Message{}).Where("message_id = ? AND status = ?", item.MessageID, "sent").
+			Update("reply_deadline", deadline).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	fmt.Printf("[Outbox] Message %s delivered (attempt %d)\n", item.MessageID, item.Attempts)
+	return func() {
+		r.hub.SendToUser(item.UserID, "delivery", map[string]interface{}{
+			"message_id":      item.MessageID,
+			"delivery_status": model.DeliveryDelivered,
+		})
+	}, nil
+}
+
+// backoff 第 attempts 次尝试失败后的等待时间：BaseDelay 按次数翻倍，不超过 MaxDelay
+func (p Policy) backoff(attempts int) time.Duration {
+	if attempts < 1 {
+		attempts = 1
+	}
+	delay := p.BaseDelay << (attempts - 1)
+	if delay <= 0 || delay > p.MaxDelay {
+		delay = p.MaxDelay
+	}
+	return delay
+}
+
+// retry 记录失败并按指数退避安排下一次投递
+func (r *Relay) retry(item *model.OutboxMessage, cause error) error {
+	delay := r.policy.backoff(item.Attempts)
+
+	fmt.Printf("[Outbox Error] Message %s attempt %d failed, retry in %s: %v\n", item.MessageID, item.Attempts, delay, cause)
+	return r.db.Model(item).Updates(map[string]interface{}{
+		"next_attempt_at": time.Now().Add(delay),
+		"last_error":      cause.Error(),
+	}).Error
+}
+
+// fail 放弃投递，消息标记为失败并通知客户端
+func (r *Relay) fail(item *model.OutboxMessage, cause error) (func(), error) {
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(item).Updates(map[string]interface{}{
+			"status":     model.OutboxFailed,
+			"last_error": cause.Error(),
+		}).Error; err != nil {
+			return err
+		}
+		return tx.Model(&model.Message{}).Where("message_id = ?", item.MessageID).
+			Updates(map[string]interface{}{
+				"delivery_status": model.DeliveryFailed,
+				"status":          "failed",
+				"reply_deadline":  nil,
+			}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	fmt.Printf("[Outbox Error] Message %s gave up after %d attempts: %v\n", item.MessageID, item.Attempts, cause)
+	return func() {
+		r.hub.SendToUser(item.UserID, "delivery", map[string]interface{}{
+			"message_id":      item.MessageID,
+			"delivery_status": model.DeliveryFailed,
+			"error":           "发送到 Telegram 失败",
+		})
+	}, nil
+}
@@ -0,0 +1,48 @@
+package outbox
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPolicyBackoff(t *testing.T) {
+	tests := []struct {
+		name     string
+		policy   Policy
+		attempts int
+		want     time.Duration
+	}{
+		{name: "first attempt", policy: DefaultPolicy, attempts: 1, want: time.Second},
+		{name: "doubles", policy: DefaultPolicy, attempts: 2, want: 2 * time.Second},
+		{name: "doubles again", policy: DefaultPolicy, attempts: 5, want: 16 * time.Second},
+		{name: "last before cap", policy: DefaultPolicy, attempts: 7, want: 64 * time.Second},
+		{name: "capped", policy: DefaultPolicy, attempts: 8, want: 2 * time.Minute},
+		{name: "overflow capped", policy: DefaultPolicy, attempts: 80, want: 2 * time.Minute},
+		{name: "zero attempts treated as first", policy: DefaultPolicy, attempts: 0, want: time.Second},
+		{
+			name:     "custom base",
+			policy:   Policy{BaseDelay: 500 * time.Millisecond, MaxDelay: time.Minute},
+			attempts: 3,
+			want:     2 * time.Second,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.policy.backoff(tt.attempts); got != tt.want {
+				t.Errorf("backoff(%d) = %v, want %v", tt.attempts, got, tt.want)
+			}
+		})
+	}
+}
+
+// 默认策略下所有重试的总等待时间，与 DefaultPolicy 注释中的“大约 6 分钟”一致
+func TestDefaultPolicyTotalDelay(t *testing.T) {
+	var total time.Duration
+	for attempts := 1; attempts < DefaultPolicy.MaxAttempts; attempts++ {
+		total += DefaultPolicy.backoff(attempts)
+	}
+	if total < 5*time.Minute || total > 7*time.Minute {
+		t.Errorf("total delay = %v, want about 6 minutes", total)
+	}
+}
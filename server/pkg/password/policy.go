@@ -0,0 +1,117 @@
+package password
+
+import (
+	"bufio"
+	"bytes"
+	_ "embed"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// common.txt 内置的常见/已泄露密码列表，每行一个，比较时忽略大小写
+// 内置列表只覆盖最常见的一小部分，生产环境建议通过 LoadCommonFile 加载完整列表（如 SecLists 的 top-10k）
+//
+//go:embed common.txt
+var commonList []byte
+
+var common = loadCommon(commonList)
+
+func loadCommon(data []byte) map[string]bool {
+	set := make(map[string]bool)
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		set[strings.ToLower(line)] = true
+	}
+	return set
+}
+
+// LoadCommonFile 从文件加载额外的常见密码列表，格式与 common.txt 相同
+func LoadCommonFile(path string) (map[string]bool, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read common password list failed: %w", err)
+	}
+	return loadCommon(data), nil
+}
+
+var (
+	ErrTooShort   = errors.New("密码太短")
+	ErrTooLong    = errors.New("密码不能超过 72 个字节")
+	ErrTooSimple  = errors.New("密码包含的字符种类太少")
+	ErrCommon     = errors.New("密码过于常见，请换一个")
+	ErrSameAsUser = errors.New("密码不能与用户名相同")
+)
+
+// maxBytes bcrypt 只使用前 72 个字节
+const maxBytes = 72
+
+// Policy 密码策略
+type Policy struct {
+	MinLength   int             // 最小长度（按字符计）
+	MinClasses  int             // 至少包含几类字符：小写、大写、数字、符号
+	CheckCommon bool            // 拒绝常见密码
+	Common      map[string]bool // 内置列表之外的常见密码（小写），由 LoadCommonFile 加载
+}
+
+// DefaultPolicy 默认策略：至少 8 位，包含两类字符，不在常见密码列表中
+var DefaultPolicy = Policy{
+	MinLength:   8,
+	MinClasses:  2,
+	CheckCommon: true,
+}
+
+// Validate 检查密码是否符合策略，username 用于拒绝与用户名相同的密码
+func (p *Policy) Validate(password, username string) error {
+	if utf8.RuneCountInString(password) < p.MinLength {
+		return fmt.Errorf("%w，至少需要 %d 位", ErrTooShort, p.MinLength)
+	}
+	if len(password) > maxBytes {
+		return ErrTooLong
+	}
+	if classes(password) < p.MinClasses {
+		return fmt.Errorf("%w，需要包含小写字母、大写字母、数字、符号中的至少 %d 类", ErrTooSimple, p.MinClasses)
+	}
+	if username != "" && strings.EqualFold(password, username) {
+		return ErrSameAsUser
+	}
+	if p.CheckCommon {
+		lower := strings.ToLower(password)
+		if common[lower] || p.Common[lower] {
+			return ErrCommon
+		}
+	}
+	return nil
+}
+
+// classes 统计密码包含的字符种类数
+func classes(password string) int {
+	var lower, upper, digit, symbol bool
+	for _, r := range password {
+		switch {
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsDigit(r):
+			digit = true
+		default:
+			symbol = true
+		}
+	}
+
+	n := 0
+	for _, ok := range []bool{lower, upper, digit, symbol} {
+		if ok {
+			n++
+		}
+	}
+	return n
+}
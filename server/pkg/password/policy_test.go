@@ -0,0 +1,67 @@
+package password
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestPolicyValidate(t *testing.T) {
+	strict := Policy{MinLength: 10, MinClasses: 3, CheckCommon: true}
+	lenient := Policy{MinLength: 4, MinClasses: 1}
+	extra := Policy{MinLength: 8, MinClasses: 2, CheckCommon: true, Common: map[string]bool{"company2026": true}}
+
+	tests := []struct {
+		name     string
+		policy   Policy
+		password string
+		username string
+		want     error
+	}{
+		{name: "default ok", policy: DefaultPolicy, password: "correct-horse", want: nil},
+		{name: "too short", policy: DefaultPolicy, password: "ab1", want: ErrTooShort},
+		{name: "length counts runes", policy: DefaultPolicy, password: "密码密码密码密1", want: nil},
+		{name: "over 72 bytes", policy: DefaultPolicy, password: strings.Repeat("a1", 37), want: ErrTooLong},
+		{name: "exactly 72 bytes", policy: DefaultPolicy, password: strings.Repeat("a1", 36), want: nil},
+		{name: "one class", policy: DefaultPolicy, password: "abcdefghij", want: ErrTooSimple},
+		{name: "three classes required", policy: strict, password: "abcdefgh12", want: ErrTooSimple},
+		{name: "three classes ok", policy: strict, password: "Abcdefgh12", want: nil},
+		{name: "symbol counts as class", policy: strict, password: "abcdefgh1!", want: nil},
+		{name: "same as username", policy: DefaultPolicy, password: "Alice2026", username: "alice2026", want: ErrSameAsUser},
+		{name: "common password", policy: DefaultPolicy, password: "password123", want: ErrCommon},
+		{name: "common ignores case", policy: DefaultPolicy, password: "PassWord123", want: ErrCommon},
+		{name: "common check disabled", policy: lenient, password: "password123", want: nil},
+		{name: "extra list", policy: extra, password: "Company2026", want: ErrCommon},
+		{name: "extra list keeps embedded", policy: extra, password: "password123", want: ErrCommon},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.policy.Validate(tt.password, tt.username)
+			if !errors.Is(err, tt.want) {
+				t.Errorf("Validate(%q) = %v, want %v", tt.password, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadCommonFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "common.txt")
+	if err := os.WriteFile(path, []byte("# comment\n\n  Hunter2  \nletmein\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	list, err := LoadCommonFile(path)
+	if err != nil {
+		t.Fatalf("LoadCommonFile: %v", err)
+	}
+	if len(list) != 2 || !list["hunter2"] || !list["letmein"] {
+		t.Errorf("list = %v, want hunter2 and letmein", list)
+	}
+
+	if _, err := LoadCommonFile(filepath.Join(t.TempDir(), "missing.txt")); err == nil {
+		t.Error("expected error for missing file")
+	}
+}
@@ -0,0 +1,125 @@
+package reply
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"talk-web/server/model"
+	"talk-web/server/pkg/telegram"
+	"talk-web/server/pkg/ws"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Handler 处理到达的回复（生成语音、保存并推送）
+type Handler interface {
+	HandleReply(message model.Message, r *telegram.Envelope)
+}
+
+// Dispatcher 回复分发器
+// 整个进程中只有它消费 Telegram 收件箱，按信封的 reply_to
+// 把回复精确路由给对应消息，交给 Handler 处理；未设置 Handler 时直接落库并推送
+// 等待中的消息登记在 pending 中（截止时间同时保存在 Message.ReplyDeadline），见 pending.go
+type Dispatcher struct {
+	tg      *telegram.TelegramClient
+	db      *gorm.DB
+	hub     *ws.Hub
+	inbox   string
+	handler Handler
+
+	mu      sync.Mutex
+	pending map[string]pendingReply // msg_id -> 等待中的消息
+}
+
+func NewDispatcher(tg *telegram.TelegramClient, db *gorm.DB, hub *ws.Hub) *Dispatcher {
+	return &Dispatcher{
+		tg:      tg,
+		db:      db,
+		hub:     hub,
+		inbox:   telegram.DefaultUser,
+		pending: make(map[string]pendingReply),
+	}
+}
+
+// SetHandler 设置回复处理器，需在 Run 之前调用
+func (d *Dispatcher) SetHandler(handler Handler) {
+	d.handler = handler
+}
+
+// Run 持续消费收件箱，直到 ctx 结束
+func (d *Dispatcher) Run(ctx context.Context) {
+	fmt.Printf("[Dispatcher] 开始消费收件箱: %s%s\n", telegram.InboxPrefix, d.inbox)
+
+	for ctx.Err() == nil {
+		msg, err := d.tg.ReceiveFromTelegram(ctx, d.inbox, 5*time.Second)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			fmt.Printf("[Dispatcher Error] %v\n", err)
+			time.Sleep(1 * time.Second)
+			continue
+		}
+		if msg == nil {
+			continue
+		}
+
+		d.dispatch(msg)
+	}
+}
+
+func (d *Dispatcher) dispatch(msg *telegram.Message) {
+	r, err := telegram.ParseEnvelope(msg)
+	if err != nil {
+		fmt.Printf("[Dispatcher] 忽略消息: %v\n", err)
+		return
+	}
+	if r.Kind != telegram.KindToWeb {
+		fmt.Printf("[Dispatcher] 忽略非 to-web 消息\n")
+		return
+	}
+
+	// 找到对应的消息，并确认归属
+	var message model.Message
+	if err := d.db.Where("message_id = ?", r.ReplyTo).First(&message).Error; err != nil {
+		fmt.Printf("[Dispatcher Warning] 未找到消息 %s: %v\n", r.ReplyTo, err)
+		return
+	}
+	if message.UserID != r.UserID {
+		fmt.Printf("[Dispatcher Warning] UserID 不匹配: 消息 %s 属于 %d, 回复指向 %d\n",
+			r.ReplyTo, message.UserID, r.UserID)
+		return
+	}
+
+	// 超时之后才到的回复同样处理，状态会从 timeout 改为 replied
+	if !d.resolve(r.ReplyTo) {
+		fmt.Printf("[Dispatcher] 消息 %s 不在等待中（已超时或重复回复），仍然保存\n", r.ReplyTo)
+	}
+
+	if d.handler != nil {
+		fmt.Printf("[Dispatcher] ✓ 交给处理器 - UserID: %d, MessageID: %s\n", r.UserID, r.ReplyTo)
+		// 语音合成较慢，不阻塞收件箱消费
+		go d.handler.HandleReply(message, r)
+		return
+	}
+
+	fmt.Printf("[Dispatcher] 无处理器，直接保存 - UserID: %d, MessageID: %s\n", r.UserID, r.ReplyTo)
+	now := time.Now()
+	if err := d.db.Model(&message).Updates(map[string]interface{}{
+		"reply":          r.Text,
+		"status":         "replied",
+		"replied_at":     now,
+		"reply_deadline": nil,
+	}).Error; err != nil {
+		fmt.Printf("[DB Error] Failed to save reply: %v\n", err)
+		return
+	}
+
+	d.hub.SendToUser(r.UserID, "reply", map[string]interface{}{
+		"message_id":      r.ReplyTo,
+		"conversation_id": message.ConversationID,
+		"reply":           r.Text,
+		"timestamp":       r.CreatedAt,
+	})
+}
@@ -0,0 +1,139 @@
+package reply
+
+import (
+	"context"
+	"fmt"
+	"talk-web/server/model"
+	"time"
+)
+
+const (
+	// Timeout 等待 Telegram 回复的最长时间
+	Timeout = 60 * time.Second
+
+	// sweepInterval 清扫器检查超时消息的间隔
+	sweepInterval = 2 * time.Second
+)
+
+// pendingReply 等待回复的消息
+type pendingReply struct {
+	userID   uint
+	deadline time.Time
+}
+
+// Track 登记等待回复的消息，截止时间应与 Message.ReplyDeadline 一致
+// 必须在消息发出之前调用，避免回复先于登记到达
+func (d *Dispatcher) Track(msgID string, userID uint, deadline time.Time) {
+	d.mu.Lock()
+	d.pending[msgID] = pendingReply{userID: userID, deadline: deadline}
+	d.mu.Unlock()
+}
+
+// Forget 取消登记（例如消息没能发出去）
+func (d *Dispatcher) Forget(msgID string) {
+	d.mu.Lock()
+	delete(d.pending, msgID)
+	d.mu.Unlock()
+}
+
+// resolve 回复到达时移出登记，返回消息此前是否在等待中
+func (d *Dispatcher) resolve(msgID string) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if _, ok := d.pending[msgID]; !ok {
+		return false
+	}
+	delete(d.pending, msgID)
+	return true
+}
+
+// Recover 启动时恢复等待中的消息
+// 还没到截止时间的重新登记，已经超时的标记为 timeout
+// 升级前保存的消息没有截止时间，按 SentAt + Timeout 计算
+func (d *Dispatcher) Recover() error {
+	var messages []model.Message
+	// 还在发件箱里的消息由转发器负责，投递成功后才开始计时
+	if err := d.db.Select("id", "message_id", "user_id", "sent_at", "reply_deadline").
+		Where("status = ? AND delivery_status = ?", "sent", model.DeliveryDelivered).
+		Find(&messages).Error; err != nil {
+		return err
+	}
+
+	now := time.Now()
+	rearmed, expired := 0, 0
+	for _, m := range messages {
+		deadline := m.SentAt.Add(Timeout)
+		if m.ReplyDeadline != nil {
+			deadline = *m.ReplyDeadline
+		}
+
+		if deadline.After(now) {
+			d.Track(m.MessageID, m.UserID, deadline)
+			rearmed++
+			continue
+		}
+		if d.expire(m.MessageID, m.UserID) {
+			expired++
+		}
+	}
+
+	fmt.Printf("[Dispatcher] 恢复等待中的消息: %d 条继续等待, %d 条已超时\n", rearmed, expired)
+	return nil
+}
+
+// Sweep 定期把超过截止时间仍未收到回复的消息标记为 timeout，直到 ctx 结束
+func (d *Dispatcher) Sweep(ctx context.Context) {
+	ticker := time.NewTicker(sweepInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			for msgID, p := range d.overdue(now) {
+				d.expire(msgID, p.userID)
+			}
+		}
+	}
+}
+
+// overdue 取出所有已超时的登记
+func (d *Dispatcher) overdue(now time.Time) map[string]pendingReply {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	expired := make(map[string]pendingReply)
+	for msgID, p := range d.pending {
+		if !now.Before(p.deadline) {
+			expired[msgID] = p
+			delete(d.pending, msgID)
+		}
+	}
+	return expired
+}
+
+// expire 把消息标记为超时并通知用户
+// 只更新仍处于 sent 的消息，回复恰好同时到达时以回复为准
+func (d *Dispatcher) expire(msgID string, userID uint) bool {
+	result := d.db.Model(&model.Message{}).
+		Where("message_id = ? AND status = ?", msgID, "sent").
+		Updates(map[string]interface{}{
+			"status":         "timeout",
+			"reply_deadline": nil,
+		})
+	if result.Error != nil {
+		fmt.Printf("[DB Error] Failed to expire message %s: %v\n", msgID, result.Error)
+		return false
+	}
+	if result.RowsAffected == 0 {
+		return false
+	}
+
+	fmt.Printf("[Telegram Error] No reply: message %s timed out\n", msgID)
+	d.hub.SendToUser(userID, "reply_timeout", map[string]interface{}{
+		"message_id": msgID,
+	})
+	return true
+}
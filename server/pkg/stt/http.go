@@ -0,0 +1,127 @@
+package stt
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// HTTPTranscriber 调用 OpenAI 兼容的 /v1/audio/transcriptions 接口
+// （whisper.cpp server、faster-whisper-server 等）
+type HTTPTranscriber struct {
+	URL      string
+	APIKey   string
+	Model    string
+	Language string
+	Timeout  time.Duration
+	client   *http.Client
+}
+
+func NewHTTPTranscriber(opts Options) *HTTPTranscriber {
+	t := &HTTPTranscriber{
+		URL:      strings.TrimRight(opts.URL, "/"),
+		APIKey:   opts.APIKey,
+		Model:    opts.Model,
+		Language: opts.Language,
+		Timeout:  opts.Timeout,
+		client:   &http.Client{},
+	}
+	if t.Model == "" {
+		t.Model = "whisper-1"
+	}
+	if t.Timeout <= 0 {
+		t.Timeout = 60 * time.Second
+	}
+	return t
+}
+
+// Transcribe 上传音频文件并返回识别文本
+func (t *HTTPTranscriber) Transcribe(audioPath string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), t.Timeout)
+	defer cancel()
+
+	body, contentType, err := t.buildForm(audioPath)
+	if err != nil {
+		return "", err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, t.URL+"/v1/audio/transcriptions", body)
+	if err != nil {
+		return "", fmt.Errorf("STT request failed: %w", err)
+	}
+	req.Header.Set("Content-Type", contentType)
+	if t.APIKey != "" {
+		req.Header.Set("Authorization", "Bearer "+t.APIKey)
+	}
+
+	resp, err := t.client.Do(req)
+	if err != nil {
+		if ctx.Err() == context.DeadlineExceeded {
+			return "", fmt.Errorf("STT timeout after %v", t.Timeout)
+		}
+		return "", fmt.Errorf("STT request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", fmt.Errorf("STT read response failed: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("STT server returned %d: %s", resp.StatusCode, strings.TrimSpace(string(data)))
+	}
+
+	var result struct {
+		Text string `json:"text"`
+	}
+	if err := json.Unmarshal(data, &result); err != nil {
+		return "", fmt.Errorf("STT unmarshal response failed: %w", err)
+	}
+
+	text := strings.TrimSpace(result.Text)
+	if text == "" {
+		return "", fmt.Errorf("no text recognized")
+	}
+
+	return text, nil
+}
+
+// buildForm 构造 multipart 请求体
+func (t *HTTPTranscriber) buildForm(audioPath string) (*bytes.Buffer, string, error) {
+	f, err := os.Open(audioPath)
+	if err != nil {
+		return nil, "", fmt.Errorf("open audio failed: %w", err)
+	}
+	defer f.Close()
+
+	body := &bytes.Buffer{}
+	w := multipart.NewWriter(body)
+
+	part, err := w.CreateFormFile("file", filepath.Base(audioPath))
+	if err != nil {
+		return nil, "", fmt.Errorf("create form file failed: %w", err)
+	}
+	if _, err := io.Copy(part, f); err != nil {
+		return nil, "", fmt.Errorf("copy audio failed: %w", err)
+	}
+
+	w.WriteField("model", t.Model)
+	w.WriteField("response_format", "json")
+	if t.Language != "" {
+		w.WriteField("language", t.Language)
+	}
+
+	if err := w.Close(); err != nil {
+		return nil, "", fmt.Errorf("close form failed: %w", err)
+	}
+
+	return body, w.FormDataContentType(), nil
+}
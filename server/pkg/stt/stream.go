@@ -0,0 +1,209 @@
+package stt
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	// maxStreamSize 单次语音流的最大字节数
+	maxStreamSize = 20 * 1024 * 1024
+	// maxPartialRuns 单次语音流最多做几次中间识别
+	maxPartialRuns = 8
+	// maxPartialSize 超过该大小后不再做中间识别，只在结束时识别一次
+	maxPartialSize = 2 * 1024 * 1024
+)
+
+// Stream 一次流式识别会话
+type Stream interface {
+	// Write 追加一段音频数据
+	Write(chunk []byte) error
+	// Close 结束输入，返回最终识别结果
+	Close() (string, error)
+	// Abort 放弃本次识别并释放资源
+	Abort()
+}
+
+// StreamingTranscriber 支持边录边识别的后端
+type StreamingTranscriber interface {
+	// NewStream 开始一次识别，onPartial 在得到中间结果时被调用
+	NewStream(ext string, onPartial func(text string)) (Stream, error)
+}
+
+// AsStreaming 把任意后端包装成流式后端
+// 后端自身支持流式时直接使用；否则每隔 interval 对已收到的音频重新识别一次作为中间结果。
+// 后者并不是真正的流式识别：每次都要从头识别整段音频，总开销随录音时长平方增长，
+// 因此中间识别最多做 maxPartialRuns 次，音频超过 maxPartialSize 后也不再做，只保留最终识别。
+// 容器格式（webm、ogg）的音频不能按字节截取后半段，所以无法用滑动窗口代替。
+func AsStreaming(t Transcriber, interval time.Duration) StreamingTranscriber {
+	if s, ok := t.(StreamingTranscriber); ok {
+		return s
+	}
+	return &bufferedStreamer{t: t, interval: interval}
+}
+
+type bufferedStreamer struct {
+	t        Transcriber
+	interval time.Duration
+}
+
+func (b *bufferedStreamer) NewStream(ext string, onPartial func(text string)) (Stream, error) {
+	f, err := os.CreateTemp("", "talk-stream-*"+ext)
+	if err != nil {
+		return nil, fmt.Errorf("create stream file failed: %w", err)
+	}
+
+	return &bufferedStream{
+		t:           b.t,
+		interval:    b.interval,
+		ext:         ext,
+		file:        f,
+		onPartial:   onPartial,
+		lastPartial: time.Now(),
+	}, nil
+}
+
+// bufferedStream 把音频块追加到临时文件，定期对整段音频做一次识别（次数和大小有上限）
+type bufferedStream struct {
+	t         Transcriber
+	interval  time.Duration
+	ext       string
+	onPartial func(text string)
+
+	mu          sync.Mutex
+	file        *os.File
+	size        int64
+	lastPartial time.Time
+	partialRuns int  // 已做的中间识别次数
+	running     bool // 中间识别进行中
+	done        bool
+}
+
+func (s *bufferedStream) Write(chunk []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.done {
+		return fmt.Errorf("stream already closed")
+	}
+	if s.size+int64(len(chunk)) > maxStreamSize {
+		return fmt.Errorf("audio stream exceeds %d bytes", maxStreamSize)
+	}
+
+	n, err := s.file.Write(chunk)
+	s.size += int64(n)
+	if err != nil {
+		return fmt.Errorf("write stream file failed: %w", err)
+	}
+
+	if s.partialAllowed() {
+		s.running = true
+		s.lastPartial = time.Now()
+		s.partialRuns++
+		go s.partial(s.size)
+	}
+	return nil
+}
+
+// partialAllowed 是否该做下一次中间识别，调用方需持有 mu
+func (s *bufferedStream) partialAllowed() bool {
+	if s.onPartial == nil || s.running || time.Since(s.lastPartial) < s.interval {
+		return false
+	}
+	return s.partialRuns < maxPartialRuns && s.size <= maxPartialSize
+}
+
+// partial 对前 size 字节做一次识别
+func (s *bufferedStream) partial(size int64) {
+	defer func() {
+		s.mu.Lock()
+		s.running = false
+		s.mu.Unlock()
+	}()
+
+	snapshot, err := s.snapshot(size)
+	if err != nil {
+		s.mu.Lock()
+		done := s.done
+		s.mu.Unlock()
+		if !done { // 已结束时临时文件被删除是正常的
+			fmt.Printf("[STT Stream Error] snapshot failed: %v\n", err)
+		}
+		return
+	}
+	defer os.Remove(snapshot)
+
+	text, err := s.t.Transcribe(snapshot)
+	if err != nil {
+		return // 音频太短时识别失败是正常的
+	}
+
+	s.mu.Lock()
+	done := s.done
+	s.mu.Unlock()
+	if !done {
+		s.onPartial(text)
+	}
+}
+
+// snapshot 复制当前已收到的音频，避免识别过程中文件被继续写入
+func (s *bufferedStream) snapshot(size int64) (string, error) {
+	src, err := os.Open(s.file.Name())
+	if err != nil {
+		return "", err
+	}
+	defer src.Close()
+
+	dst, err := os.CreateTemp("", "talk-partial-*"+s.ext)
+	if err != nil {
+		return "", err
+	}
+	if _, err := io.CopyN(dst, src, size); err != nil {
+		dst.Close()
+		os.Remove(dst.Name())
+		return "", err
+	}
+	if err := dst.Close(); err != nil {
+		os.Remove(dst.Name())
+		return "", err
+	}
+	return dst.Name(), nil
+}
+
+func (s *bufferedStream) Close() (string, error) {
+	s.mu.Lock()
+	if s.done {
+		s.mu.Unlock()
+		return "", fmt.Errorf("stream already closed")
+	}
+	s.done = true
+	s.mu.Unlock()
+
+	path := s.file.Name()
+	defer os.Remove(path)
+
+	if err := s.file.Close(); err != nil {
+		return "", fmt.Errorf("close stream file failed: %w", err)
+	}
+	if s.size == 0 {
+		return "", fmt.Errorf("no audio received")
+	}
+
+	return s.t.Transcribe(path)
+}
+
+func (s *bufferedStream) Abort() {
+	s.mu.Lock()
+	if s.done {
+		s.mu.Unlock()
+		return
+	}
+	s.done = true
+	s.mu.Unlock()
+
+	s.file.Close()
+	os.Remove(s.file.Name())
+}
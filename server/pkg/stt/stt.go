@@ -8,6 +8,55 @@ import (
 	"time"
 )
 
+// Transcriber 语音转文字后端
+type Transcriber interface {
+	// Transcribe 识别音频文件，返回文本
+	Transcribe(audioPath string) (string, error)
+}
+
+// Options 后端配置
+type Options struct {
+	Backend    string // exec、http 或 vosk
+	ScriptPath string // exec: 识别脚本路径
+	Model      string // 模型名称（exec: base/small/...，http: whisper-1 等）
+	URL        string // http: 服务地址；vosk: WebSocket 地址，例如 ws://localhost:2700
+	APIKey     string // http: 可选的 Bearer token
+	Language   string // 可选的语言提示，例如 zh
+	FFmpegPath string // vosk: 把录音解码为 PCM 的 ffmpeg
+	Timeout    time.Duration
+}
+
+// New 按配置创建语音识别后端
+func New(opts Options) (Transcriber, error) {
+	switch opts.Backend {
+	case "", "exec":
+		s := NewSTT()
+		if opts.ScriptPath != "" {
+			s.ScriptPath = opts.ScriptPath
+		}
+		if opts.Model != "" {
+			s.ModelSize = opts.Model
+		}
+		if opts.Timeout > 0 {
+			s.Timeout = opts.Timeout
+		}
+		return s, nil
+	case "http":
+		if opts.URL == "" {
+			return nil, fmt.Errorf("STT http backend requires a URL")
+		}
+		return NewHTTPTranscriber(opts), nil
+	case "vosk":
+		if opts.URL == "" {
+			return nil, fmt.Errorf("STT vosk backend requires a URL")
+		}
+		return NewVoskTranscriber(opts), nil
+	default:
+		return nil, fmt.Errorf("unknown STT backend: %s", opts.Backend)
+	}
+}
+
+// STT 调用本地识别脚本的后端
 type STT struct {
 	ScriptPath string
 	ModelSize  string
@@ -0,0 +1,301 @@
+package stt
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	// voskSampleRate 发给 Vosk 的 PCM 采样率
+	voskSampleRate = 16000
+	// voskChunkSize 每个 WebSocket 帧的 PCM 字节数（16kHz 16bit 单声道约 0.25 秒）
+	voskChunkSize = 8000
+)
+
+// VoskTranscriber 连接 vosk-server 的 WebSocket 接口做真正的流式识别
+// 浏览器录制的是 webm/opus，先用 ffmpeg 实时解码成 16kHz 单声道 PCM 再逐块发送；
+// 服务端对每块音频返回 partial（当前句的中间结果）或 text（一句话的最终结果）。
+type VoskTranscriber struct {
+	URL     string
+	Timeout time.Duration
+	decoder []string // 从 stdin 读入任意格式音频、向 stdout 输出 PCM 的命令
+}
+
+func NewVoskTranscriber(opts Options) *VoskTranscriber {
+	ffmpeg := opts.FFmpegPath
+	if ffmpeg == "" {
+		ffmpeg = "ffmpeg"
+	}
+	t := &VoskTranscriber{
+		URL:     opts.URL,
+		Timeout: opts.Timeout,
+		decoder: []string{ffmpeg, "-loglevel", "error", "-i", "pipe:0",
+			"-f", "s16le", "-ac", "1", "-ar", strconv.Itoa(voskSampleRate), "pipe:1"},
+	}
+	if t.Timeout <= 0 {
+		t.Timeout = 60 * time.Second
+	}
+	return t
+}
+
+// Transcribe 把整个文件作为一次流式识别发送
+func (t *VoskTranscriber) Transcribe(audioPath string) (string, error) {
+	f, err := os.Open(audioPath)
+	if err != nil {
+		return "", fmt.Errorf("open audio failed: %w", err)
+	}
+	defer f.Close()
+
+	stream, err := t.NewStream(filepath.Ext(audioPath), nil)
+	if err != nil {
+		return "", err
+	}
+
+	buf := make([]byte, 32*1024)
+	for {
+		n, err := f.Read(buf)
+		if n > 0 {
+			if werr := stream.Write(buf[:n]); werr != nil {
+				stream.Abort()
+				return "", werr
+			}
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			stream.Abort()
+			return "", fmt.Errorf("read audio failed: %w", err)
+		}
+	}
+
+	return stream.Close()
+}
+
+// NewStream 连接服务端并启动解码进程；ffmpeg 从输入内容识别容器格式，不需要扩展名
+func (t *VoskTranscriber) NewStream(_ string, onPartial func(text string)) (Stream, error) {
+	dialCtx, dialCancel := context.WithTimeout(context.Background(), t.Timeout)
+	defer dialCancel()
+
+	conn, _, err := websocket.DefaultDialer.DialContext(dialCtx, t.URL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("STT connect failed: %w", err)
+	}
+	if err := conn.WriteJSON(map[string]interface{}{
+		"config": map[string]interface{}{"sample_rate": voskSampleRate},
+	}); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("STT send config failed: %w", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	s := &voskStream{
+		conn:      conn,
+		cancel:    cancel,
+		timeout:   t.Timeout,
+		onPartial: onPartial,
+		pumped:    make(chan error, 1),
+		received:  make(chan error, 1),
+	}
+
+	s.cmd = exec.CommandContext(ctx, t.decoder[0], t.decoder[1:]...)
+	s.cmd.Stderr = &s.stderr
+	stdin, err := s.cmd.StdinPipe()
+	if err != nil {
+		s.release()
+		return nil, fmt.Errorf("start decoder failed: %w", err)
+	}
+	stdout, err := s.cmd.StdoutPipe()
+	if err != nil {
+		s.release()
+		return nil, fmt.Errorf("start decoder failed: %w", err)
+	}
+	if err := s.cmd.Start(); err != nil {
+		s.release()
+		return nil, fmt.Errorf("start decoder failed: %w", err)
+	}
+	s.stdin = stdin
+
+	go s.pump(stdout)
+	go s.receive()
+	return s, nil
+}
+
+// voskStream 音频块写入解码进程，pump 把 PCM 转发给服务端，receive 读取识别结果
+type voskStream struct {
+	conn      *websocket.Conn
+	cmd       *exec.Cmd
+	stdin     io.WriteCloser
+	stderr    bytes.Buffer
+	cancel    context.CancelFunc
+	timeout   time.Duration
+	onPartial func(text string)
+
+	pumped   chan error // 解码进程退出、PCM 全部发出
+	received chan error // 服务端关闭连接
+	texts    []string   // 已确定的句子，只由 receive 写入，received 之后才读取
+
+	mu   sync.Mutex
+	size int64
+	done bool
+}
+
+func (s *voskStream) Write(chunk []byte) error {
+	// 写管道可能阻塞，不能持有锁，否则 receive 无法检查 done
+	s.mu.Lock()
+	if s.done {
+		s.mu.Unlock()
+		return fmt.Errorf("stream already closed")
+	}
+	if s.size+int64(len(chunk)) > maxStreamSize {
+		s.mu.Unlock()
+		return fmt.Errorf("audio stream exceeds %d bytes", maxStreamSize)
+	}
+	s.size += int64(len(chunk))
+	s.mu.Unlock()
+
+	if _, err := s.stdin.Write(chunk); err != nil {
+		return fmt.Errorf("write decoder failed: %w", err)
+	}
+	return nil
+}
+
+// pump 把解码出的 PCM 转发给服务端，解码进程退出后回收
+func (s *voskStream) pump(stdout io.Reader) {
+	var sendErr error
+	buf := make([]byte, voskChunkSize)
+	for {
+		n, err := stdout.Read(buf)
+		// 发送失败后继续读完输出，避免解码进程阻塞在写管道上无法退出
+		if n > 0 && sendErr == nil {
+			sendErr = s.conn.WriteMessage(websocket.BinaryMessage, buf[:n])
+		}
+		if err != nil {
+			break
+		}
+	}
+
+	waitErr := s.cmd.Wait()
+	switch {
+	case sendErr != nil:
+		s.pumped <- fmt.Errorf("STT send audio failed: %w", sendErr)
+	case waitErr != nil:
+		s.pumped <- fmt.Errorf("decode audio failed: %w: %s", waitErr, strings.TrimSpace(s.stderr.String()))
+	default:
+		s.pumped <- nil
+	}
+}
+
+// receive 读取识别结果直到服务端关闭连接
+func (s *voskStream) receive() {
+	for {
+		var result struct {
+			Partial string `json:"partial"`
+			Text    string `json:"text"`
+		}
+		if err := s.conn.ReadJSON(&result); err != nil {
+			if websocket.IsCloseError(err, websocket.CloseNormalClosure) {
+				err = nil
+			}
+			s.received <- err
+			return
+		}
+
+		if text := strings.TrimSpace(result.Text); text != "" {
+			s.texts = append(s.texts, text)
+			continue
+		}
+		if partial := strings.TrimSpace(result.Partial); partial != "" && s.onPartial != nil && !s.closed() {
+			// 中间结果带上前面已确定的句子，客户端直接替换显示即可
+			s.onPartial(strings.TrimSpace(strings.Join(s.texts, " ") + " " + partial))
+		}
+	}
+}
+
+func (s *voskStream) closed() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.done
+}
+
+func (s *voskStream) Close() (string, error) {
+	s.mu.Lock()
+	if s.done {
+		s.mu.Unlock()
+		return "", fmt.Errorf("stream already closed")
+	}
+	s.done = true
+	size := s.size
+	s.mu.Unlock()
+
+	defer s.release()
+
+	if size == 0 {
+		return "", fmt.Errorf("no audio received")
+	}
+
+	// 关闭输入后解码进程输出剩余数据并退出
+	s.stdin.Close()
+
+	timer := time.NewTimer(s.timeout)
+	defer timer.Stop()
+
+	select {
+	case err := <-s.pumped:
+		if err != nil {
+			return "", err
+		}
+	case <-timer.C:
+		return "", fmt.Errorf("STT timeout after %v", s.timeout)
+	}
+
+	// eof 之后服务端返回最后一句的结果并关闭连接
+	if err := s.conn.WriteMessage(websocket.TextMessage, []byte(`{"eof" : 1}`)); err != nil {
+		return "", fmt.Errorf("STT send eof failed: %w", err)
+	}
+
+	select {
+	case err := <-s.received:
+		if err != nil {
+			return "", fmt.Errorf("STT read result failed: %w", err)
+		}
+	case <-timer.C:
+		return "", fmt.Errorf("STT timeout after %v", s.timeout)
+	}
+
+	text := strings.TrimSpace(strings.Join(s.texts, " "))
+	if text == "" {
+		return "", fmt.Errorf("no text recognized")
+	}
+	return text, nil
+}
+
+func (s *voskStream) Abort() {
+	s.mu.Lock()
+	if s.done {
+		s.mu.Unlock()
+		return
+	}
+	s.done = true
+	s.mu.Unlock()
+
+	s.stdin.Close()
+	s.release()
+}
+
+// release 结束解码进程并断开连接，pump 和 receive 随之退出
+func (s *voskStream) release() {
+	s.cancel()
+	s.conn.Close()
+}
@@ -0,0 +1,146 @@
+package stt
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// fakeVosk 按 vosk-server 的协议应答：每块音频回一个 partial，
+// 收到 8 字节后确定一句，eof 时返回最后一句并关闭连接
+type fakeVosk struct {
+	mu     sync.Mutex
+	config string
+	audio  bytes.Buffer
+}
+
+func (f *fakeVosk) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	conn, err := (&websocket.Upgrader{}).Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	sentence := 0
+	for {
+		kind, data, err := conn.ReadMessage()
+		if err != nil {
+			return
+		}
+		if kind == websocket.TextMessage {
+			if strings.Contains(string(data), "eof") {
+				conn.WriteJSON(map[string]string{"text": "再见"})
+				conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
+				return
+			}
+			f.mu.Lock()
+			f.config = string(data)
+			f.mu.Unlock()
+			continue
+		}
+
+		f.mu.Lock()
+		f.audio.Write(data)
+		size := f.audio.Len()
+		f.mu.Unlock()
+
+		if size >= 8 && sentence == 0 {
+			sentence++
+			conn.WriteJSON(map[string]string{"text": "你好"})
+		} else {
+			conn.WriteJSON(map[string]string{"partial": "世"})
+		}
+	}
+}
+
+func newFakeVosk(t *testing.T) (*fakeVosk, *VoskTranscriber) {
+	t.Helper()
+	fake := &fakeVosk{}
+	server := httptest.NewServer(fake)
+	t.Cleanup(server.Close)
+
+	// 用 cat 代替 ffmpeg，音频原样转发
+	return fake, &VoskTranscriber{
+		URL:     "ws" + strings.TrimPrefix(server.URL, "http"),
+		Timeout: 5 * time.Second,
+		decoder: []string{"cat"},
+	}
+}
+
+func TestVoskStream(t *testing.T) {
+	fake, transcriber := newFakeVosk(t)
+
+	partials := make(chan string, 16)
+	stream, err := transcriber.NewStream(".webm", func(text string) { partials <- text })
+	if err != nil {
+		t.Fatalf("NewStream: %v", err)
+	}
+
+	if err := stream.Write([]byte("abcd")); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	select {
+	case got := <-partials:
+		if got != "世" {
+			t.Errorf("first partial = %q, want %q", got, "世")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no partial received")
+	}
+
+	if err := stream.Write([]byte("efgh")); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	text, err := stream.Close()
+	if err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	if text != "你好 再见" {
+		t.Errorf("text = %q, want %q", text, "你好 再见")
+	}
+
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+	if fake.audio.String() != "abcdefgh" {
+		t.Errorf("server received %q, want %q", fake.audio.String(), "abcdefgh")
+	}
+	if !strings.Contains(fake.config, `"sample_rate":16000`) {
+		t.Errorf("config = %q, want sample_rate 16000", fake.config)
+	}
+}
+
+func TestVoskStreamAbort(t *testing.T) {
+	_, transcriber := newFakeVosk(t)
+
+	stream, err := transcriber.NewStream(".webm", nil)
+	if err != nil {
+		t.Fatalf("NewStream: %v", err)
+	}
+	stream.Write([]byte("abcd"))
+	stream.Abort()
+
+	if err := stream.Write([]byte("efgh")); err == nil {
+		t.Error("Write after Abort succeeded, want error")
+	}
+	if _, err := stream.Close(); err == nil {
+		t.Error("Close after Abort succeeded, want error")
+	}
+}
+
+func TestVoskStreamNoAudio(t *testing.T) {
+	_, transcriber := newFakeVosk(t)
+
+	stream, err := transcriber.NewStream(".webm", nil)
+	if err != nil {
+		t.Fatalf("NewStream: %v", err)
+	}
+	if _, err := stream.Close(); err == nil || !strings.Contains(err.Error(), "no audio") {
+		t.Errorf("Close = %v, want no audio error", err)
+	}
+}
@@ -0,0 +1,134 @@
+package telegram
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// EnvelopeVersion 当前信封协议版本
+const EnvelopeVersion = 1
+
+const (
+	KindFromWeb = "from-web" // 网页用户发给 bot
+	KindToWeb   = "to-web"   // bot 回复网页用户
+)
+
+// Envelope 网页与 bot 之间的结构化消息
+// 取代 "from-web:uid:msgid 内容" 形式的文本协议
+type Envelope struct {
+	Version        int          `json:"v"`
+	Kind           string       `json:"kind"`
+	MessageID      string       `json:"message_id,omitempty"`
+	UserID         uint         `json:"user_id"`
+	ConversationID uint         `json:"conversation_id,omitempty"`
+	Text           string       `json:"text"`
+	Language       string       `json:"language,omitempty"`
+	ReplyTo        string       `json:"reply_to,omitempty"` // to-web: 被回复的 from-web 消息ID
+	Attachments    []Attachment `json:"attachments,omitempty"`
+	CreatedAt      time.Time    `json:"created_at"`
+}
+
+// Attachment 信封附件
+type Attachment struct {
+	Type     string `json:"type"` // audio, image, file
+	URL      string `json:"url"`
+	MimeType string `json:"mime_type,omitempty"`
+	Name     string `json:"name,omitempty"`
+}
+
+// LegacyText 生成旧版文本协议，迁移期间仍放在 Message.Text 中供旧 bot 读取
+func (e *Envelope) LegacyText() string {
+	id := e.MessageID
+	if e.Kind == KindToWeb {
+		id = e.ReplyTo
+	}
+	return fmt.Sprintf("%s:%d:%s %s", e.Kind, e.UserID, id, e.Text)
+}
+
+// ParseEnvelope 从收件箱消息中解析信封
+// 依次尝试：Message.Envelope 字段、Text 中的 JSON 信封、旧版 to-web/from-web 文本
+func ParseEnvelope(msg *Message) (*Envelope, error) {
+	if msg.Envelope != nil {
+		return validate(msg.Envelope)
+	}
+
+	text := strings.TrimSpace(msg.Text)
+	if strings.HasPrefix(text, "{") {
+		var env Envelope
+		if err := json.Unmarshal([]byte(text), &env); err != nil {
+			return nil, fmt.Errorf("信封 JSON 解析失败: %w", err)
+		}
+		return validate(&env)
+	}
+
+	env, err := parseLegacy(msg.Text)
+	if err != nil {
+		return nil, err
+	}
+	if t, err := time.Parse(time.RFC3339, msg.Timestamp); err == nil {
+		env.CreatedAt = t
+	}
+	return env, nil
+}
+
+// parseLegacy 解析旧版格式：to-web:[user_id]:[msg_id] 内容
+func parseLegacy(text string) (*Envelope, error) {
+	var kind string
+	switch {
+	case strings.HasPrefix(text, KindToWeb+":"):
+		kind = KindToWeb
+	case strings.HasPrefix(text, KindFromWeb+":"):
+		kind = KindFromWeb
+	default:
+		return nil, fmt.Errorf("非 to-web/from-web 消息")
+	}
+
+	// 分割 header 和 content（header 以第一个空白结束）
+	header, content, found := strings.Cut(text, " ")
+	if !found {
+		return nil, fmt.Errorf("格式错误，缺少消息内容")
+	}
+
+	// 消息ID 中允许出现冒号，所以最多切三段
+	headerParts := strings.SplitN(header, ":", 3)
+	if len(headerParts) != 3 || headerParts[2] == "" {
+		return nil, fmt.Errorf("header 格式错误: %s", header)
+	}
+
+	userID, err := strconv.ParseUint(headerParts[1], 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("user_id 无效: %s", headerParts[1])
+	}
+
+	env := &Envelope{
+		Version: 0,
+		Kind:    kind,
+		UserID:  uint(userID),
+		Text:    content,
+	}
+	if kind == KindToWeb {
+		env.ReplyTo = headerParts[2]
+	} else {
+		env.MessageID = headerParts[2]
+	}
+	return env, nil
+}
+
+func validate(env *Envelope) (*Envelope, error) {
+	if env.Version > EnvelopeVersion {
+		return nil, fmt.Errorf("不支持的信封版本: %d", env.Version)
+	}
+	if env.Kind != KindToWeb && env.Kind != KindFromWeb {
+		return nil, fmt.Errorf("未知的信封类型: %s", env.Kind)
+	}
+	if env.UserID == 0 {
+		return nil, fmt.Errorf("信封缺少 user_id")
+	}
+	if env.Kind == KindToWeb && env.ReplyTo == "" {
+		return nil, fmt.Errorf("to-web 信封缺少 reply_to")
+	}
+	return env, nil
+}
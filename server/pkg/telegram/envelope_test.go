@@ -0,0 +1,123 @@
+package telegram
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseEnvelope(t *testing.T) {
+	ts := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	tests := []struct {
+		name    string
+		msg     Message
+		want    Envelope
+		wantErr bool
+	}{
+		{
+			name: "envelope field",
+			msg: Message{Envelope: &Envelope{
+				Version: EnvelopeVersion, Kind: KindToWeb, UserID: 7, ReplyTo: "m1", Text: "你好",
+			}},
+			want: Envelope{Version: EnvelopeVersion, Kind: KindToWeb, UserID: 7, ReplyTo: "m1", Text: "你好"},
+		},
+		{
+			name: "json in text",
+			msg:  Message{Text: ` {"v":1,"kind":"to-web","user_id":3,"reply_to":"abc","text":"hi"}`},
+			want: Envelope{Version: 1, Kind: KindToWeb, UserID: 3, ReplyTo: "abc", Text: "hi"},
+		},
+		{
+			name: "legacy to-web uses timestamp",
+			msg:  Message{Text: "to-web:5:msg-1 回复内容", Timestamp: ts.Format(time.RFC3339)},
+			want: Envelope{Kind: KindToWeb, UserID: 5, ReplyTo: "msg-1", Text: "回复内容", CreatedAt: ts},
+		},
+		{
+			name: "legacy ignores bad timestamp",
+			msg:  Message{Text: "to-web:5:msg-1 hi", Timestamp: "yesterday"},
+			want: Envelope{Kind: KindToWeb, UserID: 5, ReplyTo: "msg-1", Text: "hi"},
+		},
+		{name: "newer version", msg: Message{Envelope: &Envelope{Version: EnvelopeVersion + 1, Kind: KindToWeb, UserID: 1, ReplyTo: "x"}}, wantErr: true},
+		{name: "unknown kind", msg: Message{Envelope: &Envelope{Kind: "other", UserID: 1}}, wantErr: true},
+		{name: "missing user", msg: Message{Envelope: &Envelope{Kind: KindFromWeb, MessageID: "x"}}, wantErr: true},
+		{name: "to-web without reply_to", msg: Message{Envelope: &Envelope{Kind: KindToWeb, UserID: 1}}, wantErr: true},
+		{name: "broken json", msg: Message{Text: `{"kind":`}, wantErr: true},
+		{name: "plain text", msg: Message{Text: "hello"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseEnvelope(&tt.msg)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("expected error, got %+v", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !got.CreatedAt.Equal(tt.want.CreatedAt) {
+				t.Errorf("CreatedAt = %v, want %v", got.CreatedAt, tt.want.CreatedAt)
+			}
+			got.CreatedAt, tt.want.CreatedAt = time.Time{}, time.Time{}
+			if !reflect.DeepEqual(*got, tt.want) {
+				t.Errorf("got %+v, want %+v", *got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseLegacy(t *testing.T) {
+	tests := []struct {
+		name    string
+		text    string
+		want    Envelope
+		wantErr bool
+	}{
+		{
+			name: "to-web",
+			text: "to-web:12:abc 你好",
+			want: Envelope{Kind: KindToWeb, UserID: 12, ReplyTo: "abc", Text: "你好"},
+		},
+		{
+			name: "from-web",
+			text: "from-web:3:m-9 hello world",
+			want: Envelope{Kind: KindFromWeb, UserID: 3, MessageID: "m-9", Text: "hello world"},
+		},
+		{
+			name: "message id with colons",
+			text: "to-web:1:a:b:c text",
+			want: Envelope{Kind: KindToWeb, UserID: 1, ReplyTo: "a:b:c", Text: "text"},
+		},
+		{
+			name: "content keeps later spaces",
+			text: "to-web:1:x  two  spaces ",
+			want: Envelope{Kind: KindToWeb, UserID: 1, ReplyTo: "x", Text: " two  spaces "},
+		},
+		{name: "unknown prefix", text: "to-bot:1:x hi", wantErr: true},
+		{name: "missing content", text: "to-web:1:x", wantErr: true},
+		{name: "missing id", text: "to-web:1: hi", wantErr: true},
+		{name: "missing id segment", text: "to-web:1 hi", wantErr: true},
+		{name: "bad user id", text: "to-web:abc:x hi", wantErr: true},
+		{name: "negative user id", text: "to-web:-1:x hi", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseLegacy(tt.text)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("expected error, got %+v", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(*got, tt.want) {
+				t.Errorf("got %+v, want %+v", *got, tt.want)
+			}
+		})
+	}
+}
@@ -31,10 +31,13 @@ type TelegramClient struct {
 }
 
 type Message struct {
-	Text      string `json:"text"`
-	Recipient string `json:"recipient,omitempty"`
-	Sender    string `json:"sender,omitempty"`
-	Timestamp string `json:"timestamp,omitempty"`
+	Text      string    `json:"text"`
+	Recipient string    `json:"recipient,omitempty"`
+	Sender    string    `json:"sender,omitempty"`
+	Timestamp string    `json:"timestamp,omitempty"`
+	Envelope  *Envelope `json:"envelope,omitempty"` // 结构化信封，Text 保留旧版文本供旧 bot 使用
+	// IdempotencyKey 重试时保持不变（即消息ID），bot 端据此丢弃重复投递
+	IdempotencyKey string `json:"idempotency_key,omitempty"`
 }
 
 // NewTelegramClient 创建 Telegram 客户端（使用默认配置）
@@ -86,6 +89,39 @@ func (tc *TelegramClient) SendToTelegram(text string, recipient string) error {
 	return nil
 }
 
+// SendEnvelope 发送结构化信封，同时在 Text 中附带旧版文本协议
+func (tc *TelegramClient) SendEnvelope(env *Envelope, recipient string) error {
+	if recipient == "" {
+		recipient = tc.config.Recipient
+	}
+
+	env.Version = EnvelopeVersion
+	if env.CreatedAt.IsZero() {
+		env.CreatedAt = time.Now()
+	}
+
+	msg := Message{
+		Text:      env.LegacyText(),
+		Recipient: recipient,
+		Timestamp: env.CreatedAt.Format(time.RFC3339),
+		Envelope:  env,
+
+		IdempotencyKey: env.MessageID,
+	}
+
+	msgJSON, err := json.Marshal(msg)
+	if err != nil {
+		return fmt.Errorf("marshal message failed: %w", err)
+	}
+
+	err = tc.redis.LPush(tc.ctx, MessageQueue, msgJSON).Err()
+	if err != nil {
+		return fmt.Errorf("push to redis failed: %w", err)
+	}
+
+	return nil
+}
+
 // GetFromTelegram 从 Telegram 收件箱获取最新消息
 func (tc *TelegramClient) GetFromTelegram(username string) (*Message, error) {
 	if username == "" {
@@ -164,6 +200,32 @@ func (tc *TelegramClient) WaitForReply(username string, timeout time.Duration) (
 	return nil, fmt.Errorf("timeout waiting for reply")
 }
 
+// ReceiveFromTelegram 阻塞式取出收件箱中最早的一条消息（BRPOP，先进先出）
+// 超时未收到消息时返回 nil, nil
+func (tc *TelegramClient) ReceiveFromTelegram(ctx context.Context, username string, timeout time.Duration) (*Message, error) {
+	if username == "" {
+		username = tc.config.Username
+	}
+
+	key := InboxPrefix + username
+
+	result, err := tc.redis.BRPop(ctx, timeout, key).Result()
+	if err == redis.Nil {
+		return nil, nil // 没有消息
+	}
+	if err != nil {
+		return nil, fmt.Errorf("brpop from redis failed: %w", err)
+	}
+
+	// result[0] 是 key，result[1] 是消息内容
+	var msg Message
+	if err := json.Unmarshal([]byte(result[1]), &msg); err != nil {
+		return nil, fmt.Errorf("unmarshal message failed: %w", err)
+	}
+
+	return &msg, nil
+}
+
 // Close 关闭 Redis 连接
 func (tc *TelegramClient) Close() error {
 	return tc.redis.Close()
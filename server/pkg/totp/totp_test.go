@@ -0,0 +1,132 @@
+package totp
+
+import (
+	"testing"
+	"time"
+)
+
+// rfcSecret RFC 6238 附录 B 的 SHA-1 测试密钥 "12345678901234567890"
+const rfcSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestValidateRFCVectors(t *testing.T) {
+	// RFC 给出的是 8 位验证码，6 位取其后 6 位
+	tests := []struct {
+		unix int64
+		code string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+	}
+
+	for _, tt := range tests {
+		at := time.Unix(tt.unix, 0)
+		step, ok := Validate(rfcSecret, tt.code, at)
+		if !ok {
+			t.Errorf("Validate(%s) at %d = false, want true", tt.code, tt.unix)
+			continue
+		}
+		if step != Step(at) {
+			t.Errorf("step = %d, want %d", step, Step(at))
+		}
+	}
+}
+
+func TestValidateSkew(t *testing.T) {
+	// 验证码 287082 属于第 1 个窗口（30s-59s）
+	const code = "287082"
+
+	tests := []struct {
+		name     string
+		secret   string
+		unix     int64
+		wantOK   bool
+		wantStep int64
+	}{
+		{name: "same step", secret: rfcSecret, unix: 45, wantOK: true, wantStep: 1},
+		{name: "one step early", secret: rfcSecret, unix: 15, wantOK: true, wantStep: 1},
+		{name: "one step late", secret: rfcSecret, unix: 75, wantOK: true, wantStep: 1},
+		{name: "two steps late", secret: rfcSecret, unix: 95, wantOK: false},
+		{name: "far future", secret: rfcSecret, unix: 3600, wantOK: false},
+		{name: "lowercase secret", secret: "gezdgnbvgy3tqojqgezdgnbvgy3tqojq", unix: 45, wantOK: true, wantStep: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			step, ok := Validate(tt.secret, code, time.Unix(tt.unix, 0))
+			if ok != tt.wantOK {
+				t.Fatalf("ok = %v, want %v", ok, tt.wantOK)
+			}
+			if ok && step != tt.wantStep {
+				t.Errorf("step = %d, want %d", step, tt.wantStep)
+			}
+		})
+	}
+}
+
+func TestValidateRejectsMalformed(t *testing.T) {
+	at := time.Unix(59, 0)
+	tests := []struct {
+		name   string
+		secret string
+		code   string
+		wantOK bool
+	}{
+		{name: "surrounding spaces", secret: rfcSecret, code: " 287082 ", wantOK: true},
+		{name: "wrong code", secret: rfcSecret, code: "287083"},
+		{name: "too short", secret: rfcSecret, code: "28708"},
+		{name: "eight digits", secret: rfcSecret, code: "94287082"},
+		{name: "empty", secret: rfcSecret, code: ""},
+		{name: "bad secret", secret: "not base32!", code: "287082"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, ok := Validate(tt.secret, tt.code, at); ok != tt.wantOK {
+				t.Errorf("ok = %v, want %v", ok, tt.wantOK)
+			}
+		})
+	}
+}
+
+// 调用方记录上次使用的窗口序号，只接受更大的窗口（见 handler.verifySecondFactor）
+func TestValidateReplay(t *testing.T) {
+	tests := []struct {
+		name     string
+		lastStep int64
+		unix     int64
+		code     string
+		want     bool
+	}{
+		{name: "first use", lastStep: 0, unix: 59, code: "287082", want: true},
+		{name: "same code again", lastStep: 1, unix: 59, code: "287082", want: false},
+		{name: "same code in skew window", lastStep: 1, unix: 75, code: "287082", want: false},
+		{name: "older code after newer one", lastStep: 2, unix: 75, code: "287082", want: false},
+		{name: "later step", lastStep: 1, unix: 1111111109, code: "081804", want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			step, ok := Validate(rfcSecret, tt.code, time.Unix(tt.unix, 0))
+			if accepted := ok && step > tt.lastStep; accepted != tt.want {
+				t.Errorf("accepted = %v (step %d, ok %v), want %v", accepted, step, ok, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewSecret(t *testing.T) {
+	a, err := NewSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := NewSecret()
+	if a == b {
+		t.Error("two secrets are equal")
+	}
+	if key, err := encoding.DecodeString(a); err != nil || len(key) != 20 {
+		t.Errorf("secret %q decodes to %d bytes, err %v", a, len(key), err)
+	}
+}
@@ -0,0 +1,165 @@
+package tts
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// HTTPSynthesizer 调用 HTTP 语音合成服务
+//   - openai: OpenAI 兼容的 POST /v1/audio/speech
+//   - piper:  Piper HTTP server，POST / 返回 WAV
+type HTTPSynthesizer struct {
+	URL       string
+	Style     string
+	APIKey    string
+	Model     string
+	OutputDir string
+	Defaults  SynthesizeOptions
+	Timeout   time.Duration
+	client    *http.Client
+	voices    []string
+}
+
+// DefaultOpenAIVoice 未配置默认音色时 openai 接口使用的音色（voice 是必填字段）
+const DefaultOpenAIVoice = "alloy"
+
+// openaiVoices OpenAI /v1/audio/speech 支持的音色
+var openaiVoices = []string{"alloy", "ash", "ballad", "coral", "echo", "fable", "nova", "onyx", "sage", "shimmer", "verse"}
+
+func NewHTTPSynthesizer(opts Options) (*HTTPSynthesizer, error) {
+	s := &HTTPSynthesizer{
+		URL:       strings.TrimRight(opts.URL, "/"),
+		Style:     opts.Style,
+		APIKey:    opts.APIKey,
+		Model:     opts.Model,
+		OutputDir: opts.OutputDir,
+		Defaults:  opts.Defaults,
+		Timeout:   opts.Timeout,
+		client:    &http.Client{},
+	}
+	if s.Style == "" {
+		s.Style = "openai"
+	}
+	if s.Style != "openai" && s.Style != "piper" {
+		return nil, fmt.Errorf("unknown TTS http style: %s", s.Style)
+	}
+	if s.Style == "openai" && s.Defaults.Voice == "" {
+		s.Defaults.Voice = DefaultOpenAIVoice
+	}
+	if s.Style == "openai" {
+		s.voices = voiceList(opts.Voices, openaiVoices, s.Defaults.Voice)
+	} else {
+		// Piper 的音色取决于服务端加载的模型，只允许配置过的音色
+		s.voices = voiceList(opts.Voices, nil, s.Defaults.Voice)
+	}
+	if s.Model == "" {
+		s.Model = "tts-1"
+	}
+	if s.OutputDir == "" {
+		s.OutputDir = os.TempDir()
+	}
+	if s.Timeout <= 0 {
+		s.Timeout = 30 * time.Second
+	}
+	return s, nil
+}
+
+// Voices 合成服务支持的音色
+func (s *HTTPSynthesizer) Voices() []string {
+	return s.voices
+}
+
+// Synthesize 请求合成服务并把音频写入 OutputDir
+func (s *HTTPSynthesizer) Synthesize(text string, opts SynthesizeOptions) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), s.Timeout)
+	defer cancel()
+
+	opts = opts.merge(s.Defaults)
+
+	var (
+		endpoint string
+		payload  map[string]interface{}
+		ext      string
+	)
+	switch s.Style {
+	case "piper":
+		endpoint = s.URL + "/"
+		payload = map[string]interface{}{"text": text}
+		if opts.Voice != "" {
+			payload["voice"] = opts.Voice
+		}
+		if opts.Rate > 0 {
+			// Piper 用 length_scale 控制语速，数值越大越慢
+			payload["length_scale"] = 1 / opts.Rate
+		}
+		ext = "wav"
+	default:
+		endpoint = s.URL + "/v1/audio/speech"
+		format := opts.Format
+		if format == "" {
+			format = "mp3"
+		}
+		payload = map[string]interface{}{
+			"model":           s.Model,
+			"input":           text,
+			"voice":           opts.Voice,
+			"response_format": format,
+		}
+		if opts.Rate > 0 {
+			payload["speed"] = opts.Rate
+		}
+		ext = format
+	}
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return "", fmt.Errorf("TTS marshal request failed: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return "", fmt.Errorf("TTS request failed: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if s.APIKey != "" {
+		req.Header.Set("Authorization", "Bearer "+s.APIKey)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		if ctx.Err() == context.DeadlineExceeded {
+			return "", fmt.Errorf("TTS timeout after %v", s.Timeout)
+		}
+		return "", fmt.Errorf("TTS request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		detail, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return "", fmt.Errorf("TTS server returned %d: %s", resp.StatusCode, strings.TrimSpace(string(detail)))
+	}
+
+	filePath := filepath.Join(s.OutputDir, fmt.Sprintf("talk-tts-%d.%s", time.Now().UnixNano(), ext))
+	out, err := os.Create(filePath)
+	if err != nil {
+		return "", fmt.Errorf("TTS create file failed: %w", err)
+	}
+	if _, err := io.Copy(out, resp.Body); err != nil {
+		out.Close()
+		os.Remove(filePath)
+		return "", fmt.Errorf("TTS write file failed: %w", err)
+	}
+	if err := out.Close(); err != nil {
+		return "", fmt.Errorf("TTS write file failed: %w", err)
+	}
+
+	return filePath, nil
+}
@@ -3,14 +3,132 @@ package tts
 import (
 	"context"
 	"fmt"
+	"math"
 	"os/exec"
+	"regexp"
 	"strings"
 	"time"
 )
 
+// SynthesizeOptions 单次合成的参数，零值表示使用后端默认值
+type SynthesizeOptions struct {
+	Voice  string  // 音色，例如 zh-CN-XiaoxiaoNeural、alloy
+	Rate   float64 // 语速倍率，1.0 为正常
+	Pitch  string  // 音调，格式由后端决定，例如 +5Hz
+	Format string  // 输出格式：mp3、wav、opus
+}
+
+// Synthesizer 文字转语音后端
+type Synthesizer interface {
+	// Synthesize 合成语音，返回生成的音频文件路径
+	Synthesize(text string, opts SynthesizeOptions) (string, error)
+	// Voices 用户可以选择的音色（不设置音色、使用默认值总是允许的）
+	Voices() []string
+}
+
+// edgeVoices 本地脚本（edge-tts）默认可选的中文音色
+var edgeVoices = []string{
+	"zh-CN-XiaoxiaoNeural",
+	"zh-CN-XiaoyiNeural",
+	"zh-CN-YunjianNeural",
+	"zh-CN-YunxiNeural",
+	"zh-CN-YunxiaNeural",
+	"zh-CN-YunyangNeural",
+	"zh-CN-liaoning-XiaobeiNeural",
+	"zh-CN-shaanxi-XiaoniNeural",
+}
+
+var pitchPattern = regexp.MustCompile(`^[+-]\d+Hz$`)
+
+// ValidPitch 音调格式为 +5Hz、-10Hz
+func ValidPitch(pitch string) bool {
+	return pitchPattern.MatchString(pitch)
+}
+
+// voiceList 优先使用配置的音色列表，否则使用后端内置列表；默认音色总是包含在内
+func voiceList(configured, builtin []string, defaultVoice string) []string {
+	voices := builtin
+	if len(configured) > 0 {
+		voices = configured
+	}
+	list := make([]string, 0, len(voices)+1)
+	seen := map[string]bool{}
+	for _, voice := range append([]string{defaultVoice}, voices...) {
+		if voice = strings.TrimSpace(voice); voice != "" && !seen[voice] {
+			seen[voice] = true
+			list = append(list, voice)
+		}
+	}
+	return list
+}
+
+// Options 后端配置
+type Options struct {
+	Backend    string   // exec 或 http
+	ScriptPath string   // exec: 合成脚本路径
+	ScriptOpts bool     // exec: 脚本接受 --voice 等选项，否则只传位置参数
+	URL        string   // http: 服务地址
+	Style      string   // http: openai 或 piper
+	APIKey     string   // http: 可选的 Bearer token
+	Model      string   // http: 模型名称
+	OutputDir  string   // http: 音频输出目录
+	Voices     []string // 用户可选的音色，为空时使用后端内置列表
+	Defaults   SynthesizeOptions
+	Timeout    time.Duration
+}
+
+// New 按配置创建语音合成后端
+func New(opts Options) (Synthesizer, error) {
+	switch opts.Backend {
+	case "", "exec":
+		t := NewTTS()
+		if opts.ScriptPath != "" {
+			t.ScriptPath = opts.ScriptPath
+		}
+		if opts.Timeout > 0 {
+			t.Timeout = opts.Timeout
+		}
+		t.Defaults = opts.Defaults
+		t.ScriptOpts = opts.ScriptOpts
+		if t.ScriptOpts {
+			t.voices = voiceList(opts.Voices, edgeVoices, opts.Defaults.Voice)
+		}
+		return t, nil
+	case "http":
+		if opts.URL == "" {
+			return nil, fmt.Errorf("TTS http backend requires a URL")
+		}
+		return NewHTTPSynthesizer(opts)
+	default:
+		return nil, fmt.Errorf("unknown TTS backend: %s", opts.Backend)
+	}
+}
+
+// merge 用默认值补全未设置的参数
+func (o SynthesizeOptions) merge(defaults SynthesizeOptions) SynthesizeOptions {
+	if o.Voice == "" {
+		o.Voice = defaults.Voice
+	}
+	if o.Rate == 0 {
+		o.Rate = defaults.Rate
+	}
+	if o.Pitch == "" {
+		o.Pitch = defaults.Pitch
+	}
+	if o.Format == "" {
+		o.Format = defaults.Format
+	}
+	return o
+}
+
+// TTS 调用本地合成脚本的后端
+// 默认按 xiaoxiao-tts 的约定只传位置参数 text [outputPath]；ScriptOpts 为 true 时才传合成选项
 type TTS struct {
 	ScriptPath string
+	ScriptOpts bool
 	Timeout    time.Duration
+	Defaults   SynthesizeOptions
+	voices     []string
 }
 
 func NewTTS() *TTS {
@@ -20,12 +138,21 @@ func NewTTS() *TTS {
 	}
 }
 
-// Generate 生成语音文件（自动路径）
-func (t *TTS) Generate(text string) (string, error) {
+// Voices 脚本支持的音色，脚本不接受选项时为空（只能使用默认音色）
+func (t *TTS) Voices() []string {
+	return t.voices
+}
+
+// Synthesize 调用脚本合成语音
+// 合成参数以 edge-tts 风格的选项传给脚本：--voice、--rate（如 +20%）、--pitch（如 +5Hz）、--format，
+// 未设置的参数不传，脚本保持原有的默认音色
+func (t *TTS) Synthesize(text string, opts SynthesizeOptions) (string, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), t.Timeout)
 	defer cancel()
 
-	cmd := exec.CommandContext(ctx, t.ScriptPath, text)
+	opts = opts.merge(t.Defaults)
+
+	cmd := exec.CommandContext(ctx, t.ScriptPath, t.args(opts, text)...)
 	output, err := cmd.Output()
 	if err != nil {
 		if ctx.Err() == context.DeadlineExceeded {
@@ -43,12 +170,17 @@ func (t *TTS) Generate(text string) (string, error) {
 	return filePath, nil
 }
 
+// Generate 使用默认参数生成语音文件（自动路径）
+func (t *TTS) Generate(text string) (string, error) {
+	return t.Synthesize(text, SynthesizeOptions{})
+}
+
 // GenerateWithPath 生成到指定路径
 func (t *TTS) GenerateWithPath(text, outputPath string) error {
 	ctx, cancel := context.WithTimeout(context.Background(), t.Timeout)
 	defer cancel()
 
-	cmd := exec.CommandContext(ctx, t.ScriptPath, text, outputPath)
+	cmd := exec.CommandContext(ctx, t.ScriptPath, t.args(t.Defaults, text, outputPath)...)
 	if err := cmd.Run(); err != nil {
 		if ctx.Err() == context.DeadlineExceeded {
 			return fmt.Errorf("TTS timeout after %v", t.Timeout)
@@ -58,3 +190,30 @@ func (t *TTS) GenerateWithPath(text, outputPath string) error {
 
 	return nil
 }
+
+// args 组装脚本参数，选项之后用 -- 分隔，避免以 - 开头的文本被当成选项
+func (t *TTS) args(opts SynthesizeOptions, positional ...string) []string {
+	if !t.ScriptOpts {
+		return positional
+	}
+	return append(append(scriptArgs(opts), "--"), positional...)
+}
+
+// scriptArgs 把合成参数转换为脚本选项
+func scriptArgs(opts SynthesizeOptions) []string {
+	var args []string
+	if opts.Voice != "" {
+		args = append(args, "--voice", opts.Voice)
+	}
+	if opts.Rate != 0 {
+		// edge-tts 的语速是相对正常语速的百分比，例如 1.2 倍为 +20%
+		args = append(args, "--rate", fmt.Sprintf("%+d%%", int(math.Round((opts.Rate-1)*100))))
+	}
+	if opts.Pitch != "" {
+		args = append(args, "--pitch", opts.Pitch)
+	}
+	if opts.Format != "" {
+		args = append(args, "--format", opts.Format)
+	}
+	return args
+}
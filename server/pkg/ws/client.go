@@ -12,35 +12,82 @@ const (
 	writeWait      = 10 * time.Second
 	pongWait       = 60 * time.Second
 	pingPeriod     = (pongWait * 9) / 10
-	maxMessageSize = 512
+	maxMessageSize = 64 * 1024 // 需要容纳流式识别的音频块
 )
 
-// Client WebSocket 客户端
+// ClientHandler 处理客户端上行的业务消息（ack 以外的文本消息和二进制音频帧）
+type ClientHandler interface {
+	HandleText(c *Client, msg *ClientMessage)
+	HandleBinary(c *Client, data []byte)
+	// Closed 在连接断开时调用，用于清理该连接上的会话
+	Closed(c *Client)
+}
+
+// Client Hub 客户端（WebSocket 连接，或 conn 为 nil 的 SSE 连接）
 type Client struct {
-	UserID   uint
-	Username string
-	hub      *Hub
-	conn     *websocket.Conn
-	send     chan *Message
+	UserID    uint
+	Username  string
+	DeviceID  string // 设备/标签页标识，同一用户可同时有多个连接
+	SessionID uint   // 建立连接所用的登录会话，API key 连接为 0
+	hub       *Hub
+	conn      *websocket.Conn
+	send      chan *Message
+	handler   ClientHandler
+
+	replay      bool // WritePump 开始时先补发 replayAfter 之后的事件
+	replayAfter uint64
 }
 
-func NewClient(userID uint, username string, hub *Hub, conn *websocket.Conn) *Client {
+func NewClient(userID uint, username, deviceID string, sessionID uint, hub *Hub, conn *websocket.Conn) *Client {
 	return &Client{
-		UserID:   userID,
-		Username: username,
-		hub:      hub,
-		conn:     conn,
-		send:     make(chan *Message, 256),
+		UserID:    userID,
+		Username:  username,
+		DeviceID:  deviceID,
+		SessionID: sessionID,
+		hub:       hub,
+		conn:      conn,
+		send:      make(chan *Message, 256),
 	}
 }
 
-// ReadPump 读取客户端消息（主要用于心跳）
+// SetHandler 设置上行消息的处理者，需在 ReadPump 启动前调用
+func (c *Client) SetHandler(handler ClientHandler) {
+	c.handler = handler
+}
+
+// SetReplay 断线重连时补发 lastEventID 之后的事件，需在 WritePump 启动前调用
+func (c *Client) SetReplay(lastEventID uint64) {
+	c.replay = true
+	c.replayAfter = lastEventID
+}
+
+// Messages 待发送给该客户端的消息
+// SSE 等不使用 WebSocket 连接的传输层直接从这里读取，channel 关闭表示已被注销
+func (c *Client) Messages() <-chan *Message {
+	return c.send
+}
+
+// ClientMessage 客户端发来的消息
+type ClientMessage struct {
+	Type   string `json:"type"`             // ack, start_utterance, end_utterance, cancel_utterance
+	ID     uint64 `json:"id,omitempty"`     // ack: 已收到的最大事件序号
+	MsgID  string `json:"msg_id,omitempty"` // start_utterance: 前端生成的消息ID
+	Format string `json:"format,omitempty"` // start_utterance: 音频格式，例如 webm
+
+	ConversationID uint `json:"conversation_id,omitempty"` // start_utterance: 所属会话
+}
+
+// ReadPump 读取客户端消息（心跳、事件确认和流式音频）
 func (c *Client) ReadPump() {
 	defer func() {
+		if c.handler != nil {
+			c.handler.Closed(c)
+		}
 		c.hub.Unregister(c)
 		c.conn.Close()
 	}()
 
+	c.conn.SetReadLimit(maxMessageSize)
 	c.conn.SetReadDeadline(time.Now().Add(pongWait))
 	c.conn.SetPongHandler(func(string) error {
 		c.conn.SetReadDeadline(time.Now().Add(pongWait))
@@ -48,13 +95,35 @@ func (c *Client) ReadPump() {
 	})
 
 	for {
-		_, _, err := c.conn.ReadMessage()
+		msgType, data, err := c.conn.ReadMessage()
 		if err != nil {
 			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
 				log.Printf("WebSocket error: %v", err)
 			}
 			break
 		}
+
+		// 二进制帧是录音中的音频块
+		if msgType == websocket.BinaryMessage {
+			if c.handler != nil {
+				c.handler.HandleBinary(c, data)
+			}
+			continue
+		}
+
+		var in ClientMessage
+		if err := json.Unmarshal(data, &in); err != nil {
+			continue
+		}
+
+		switch in.Type {
+		case "ack":
+			c.hub.Ack(c.UserID, in.ID)
+		default:
+			if c.handler != nil {
+				c.handler.HandleText(c, &in)
+			}
+		}
 	}
 }
 
@@ -66,23 +135,30 @@ func (c *Client) WritePump() {
 		c.conn.Close()
 	}()
 
+	// 先补发离线期间的事件；注册后到达的新事件暂存在 send 中，
+	// 其中已经补发过的（序号不大于 replayed）直接跳过
+	var replayed uint64
+	if c.replay {
+		var err error
+		replayed, err = c.hub.Replay(c.UserID, c.replayAfter, c.write)
+		if err != nil {
+			log.Printf("WebSocket replay error: user=%d %v", c.UserID, err)
+			return
+		}
+	}
+
 	for {
 		select {
 		case message, ok := <-c.send:
-			c.conn.SetWriteDeadline(time.Now().Add(writeWait))
 			if !ok {
+				c.conn.SetWriteDeadline(time.Now().Add(writeWait))
 				c.conn.WriteMessage(websocket.CloseMessage, []byte{})
 				return
 			}
-
-			// 发送 JSON 消息
-			data, err := json.Marshal(message)
-			if err != nil {
-				log.Printf("JSON marshal error: %v", err)
-				return
+			if message.ID != 0 && message.ID <= replayed {
+				continue
 			}
-
-			if err := c.conn.WriteMessage(websocket.TextMessage, data); err != nil {
+			if err := c.write(message); err != nil {
 				return
 			}
 
@@ -94,3 +170,15 @@ func (c *Client) WritePump() {
 		}
 	}
 }
+
+// write 以 JSON 文本帧发送一条消息，只能在 WritePump 所在的协程调用
+func (c *Client) write(message *Message) error {
+	data, err := json.Marshal(message)
+	if err != nil {
+		log.Printf("JSON marshal error: %v", err)
+		return err
+	}
+
+	c.conn.SetWriteDeadline(time.Now().Add(writeWait))
+	return c.conn.WriteMessage(websocket.TextMessage, data)
+}
@@ -1,20 +1,14 @@
 package ws
 
 import (
-	"context"
-	"encoding/json"
 	"fmt"
-	"strings"
 	"sync"
-	"time"
-
-	"github.com/redis/go-redis/v9"
 )
 
 // Hub 管理所有 WebSocket 连接
 type Hub struct {
-	// 用户ID -> 客户端连接
-	clients map[uint]*Client
+	// 用户ID -> 该用户的所有连接（每个设备/标签页一个）
+	clients map[uint]map[*Client]bool
 	mu      sync.RWMutex
 
 	// 注册新客户端
@@ -25,23 +19,29 @@ type Hub struct {
 
 	// 广播消息到指定用户
 	broadcast chan *Message
+
+	// 事件存储（为 nil 时不持久化，也不支持补发）
+	store EventStore
 }
 
 // Message WebSocket 消息
 type Message struct {
-	UserID  uint        `json:"user_id"`
-	Type    string      `json:"type"` // reply, status, error
-	Data    interface{} `json:"data"`
+	ID       uint64      `json:"id,omitempty"` // 用户内单调递增的事件序号，临时消息为 0
+	UserID   uint        `json:"user_id"`
+	DeviceID string      `json:"device_id,omitempty"` // 为空表示发给该用户的所有设备
+	Type     string      `json:"type"`                // reply, status, error
+	Data     interface{} `json:"data"`
 }
 
 var GlobalHub *Hub
 
-func NewHub() *Hub {
+func NewHub(store EventStore) *Hub {
 	return &Hub{
-		clients:    make(map[uint]*Client),
+		clients:    make(map[uint]map[*Client]bool),
 		register:   make(chan *Client),
 		unregister: make(chan *Client),
 		broadcast:  make(chan *Message, 256),
+		store:      store,
 	}
 }
 
@@ -50,34 +50,85 @@ func (h *Hub) Run() {
 		select {
 		case client := <-h.register:
 			h.mu.Lock()
-			h.clients[client.UserID] = client
+			if h.clients[client.UserID] == nil {
+				h.clients[client.UserID] = make(map[*Client]bool)
+			}
+			h.clients[client.UserID][client] = true
 			h.mu.Unlock()
 
 		case client := <-h.unregister:
 			h.mu.Lock()
-			if _, ok := h.clients[client.UserID]; ok {
-				delete(h.clients, client.UserID)
-				close(client.send)
-			}
+			h.remove(client)
 			h.mu.Unlock()
 
 		case message := <-h.broadcast:
-			h.mu.RLock()
-			client, ok := h.clients[message.UserID]
-			h.mu.RUnlock()
-
-			if ok {
+			h.mu.Lock()
+			for client := range h.clients[message.UserID] {
+				if message.DeviceID != "" && client.DeviceID != message.DeviceID {
+					continue
+				}
 				select {
 				case client.send <- message:
 				default:
-					// 发送失败，关闭连接
-					h.mu.Lock()
-					delete(h.clients, client.UserID)
-					close(client.send)
-					h.mu.Unlock()
+					// 发送失败，只关闭这一个连接
+					h.remove(client)
 				}
 			}
+			h.mu.Unlock()
+		}
+	}
+}
+
+// remove 移除单个连接，调用方需持有写锁
+func (h *Hub) remove(client *Client) {
+	conns, ok := h.clients[client.UserID]
+	if !ok || !conns[client] {
+		return
+	}
+	delete(conns, client)
+	close(client.send)
+	if len(conns) == 0 {
+		delete(h.clients, client.UserID)
+	}
+}
+
+// DisconnectUser 断开用户的所有连接（令牌失效时调用）
+// 断开前先发送一条 status 消息，客户端据此跳转登录而不是自动重连
+func (h *Hub) DisconnectUser(userID uint, reason string) {
+	h.disconnect(userID, reason, func(*Client) bool { return true })
+}
+
+// DisconnectSession 断开某个登录会话建立的连接（登出或撤销会话时调用）
+func (h *Hub) DisconnectSession(userID, sessionID uint, reason string) {
+	h.disconnect(userID, reason, func(c *Client) bool { return c.SessionID == sessionID })
+}
+
+// DisconnectOtherSessions 断开除 keepSessionID 以外的所有连接（修改密码时保留当前设备）
+func (h *Hub) DisconnectOtherSessions(userID, keepSessionID uint, reason string) {
+	h.disconnect(userID, reason, func(c *Client) bool { return c.SessionID != keepSessionID })
+}
+
+func (h *Hub) disconnect(userID uint, reason string, match func(*Client) bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	msg := &Message{
+		UserID: userID,
+		Type:   "status",
+		Data: map[string]interface{}{
+			"event":  "revoked",
+			"reason": reason,
+		},
+	}
+	for client := range h.clients[userID] {
+		if !match(client) {
+			continue
 		}
+		select {
+		case client.send <- msg:
+		default:
+		}
+		h.remove(client)
 	}
 }
 
@@ -91,121 +142,101 @@ func (h *Hub) Unregister(client *Client) {
 	h.unregister <- client
 }
 
-// SendToUser 发送消息给指定用户
+// SendToUser 发送消息给指定用户的所有设备
+// 消息会先持久化并分配序号，离线的设备重连时可以补发
 func (h *Hub) SendToUser(userID uint, msgType string, data interface{}) {
 	msg := &Message{
 		UserID: userID,
 		Type:   msgType,
 		Data:   data,
 	}
-	h.broadcast <- msg
-}
-
-// BroadcastToAll 广播消息给所有在线用户
-func (h *Hub) BroadcastToAll(msgType string, data interface{}) {
-	h.mu.RLock()
-	defer h.mu.RUnlock()
-
-	for userID, client := range h.clients {
-		msg := &Message{
-			UserID: userID,
-			Type:   msgType,
-			Data:   data,
-		}
-		select {
-		case client.send <- msg:
-		default:
-			// 发送失败，跳过
+	if h.store != nil {
+		if err := h.store.Append(msg); err != nil {
+			fmt.Printf("[WebSocket Hub Error] 保存事件失败: %v\n", err)
 		}
 	}
+	h.broadcast <- msg
 }
 
-// RedisMessage Redis 收件箱消息格式
-type RedisMessage struct {
-	Text      string `json:"text"`
-	Timestamp string `json:"timestamp"`
-}
-
-// StartRedisListener 启动 Redis 监听器，自动把新消息推送给所有客户端
-func (h *Hub) StartRedisListener(redisAddr string) {
-	rdb := redis.NewClient(&redis.Options{
-		Addr: redisAddr,
-		DB:   0,
-	})
+// replayPageSize 补发时每次从存储读取的事件数
+const replayPageSize = 200
 
-	ctx := context.Background()
-	inboxKey := "inbox:AlbertClaudeBot"
-
-	fmt.Printf("[WebSocket Hub] 开始监听 Redis: %s\n", inboxKey)
-
-	lastProcessedIndex := int64(-1) // 记录最后处理的消息索引
+// Replay 把序号大于 lastEventID 的事件逐条交给 write，返回最后写出的序号
+// 补发直接写到重连的那个连接上，不经过 broadcast：离线期间积压的事件可能远多于
+// 发送缓冲区，经过 Hub 会导致连接被当作过慢而关闭，也会阻塞其它用户的消息
+func (h *Hub) Replay(userID uint, lastEventID uint64, write func(*Message) error) (uint64, error) {
+	if h.store == nil {
+		return lastEventID, nil
+	}
 
+	last := lastEventID
 	for {
-		// 非阻塞式获取消息列表 (LRANGE)，不删除消息
-		result, err := rdb.LRange(ctx, inboxKey, 0, -1).Result()
+		messages, err := h.store.Since(userID, last, replayPageSize)
 		if err != nil {
-			fmt.Printf("[Redis Error] %v\n", err)
-			time.Sleep(1 * time.Second)
-			continue
+			return last, err
 		}
-
-		// 如果没有新消息，等待一会儿
-		if len(result) == 0 || int64(len(result))-1 <= lastProcessedIndex {
-			time.Sleep(1 * time.Second)
-			continue
+		for _, msg := range messages {
+			if err := write(msg); err != nil {
+				return last, err
+			}
+			last = msg.ID
 		}
+		if len(messages) < replayPageSize {
+			return last, nil
+		}
+	}
+}
 
-		// 处理新消息（从最后处理的索引+1开始）
-		for i := lastProcessedIndex + 1; i < int64(len(result)); i++ {
-			msgJSON := result[i]
-			lastProcessedIndex = i
-
-			var msg RedisMessage
-			if err := json.Unmarshal([]byte(msgJSON), &msg); err != nil {
-				fmt.Printf("[Redis Error] JSON 解析失败: %v\n", err)
-				continue
-			}
+// Ack 客户端确认已收到序号不大于 id 的事件
+func (h *Hub) Ack(userID uint, id uint64) {
+	if h.store == nil {
+		return
+	}
+	if err := h.store.Ack(userID, id); err != nil {
+		fmt.Printf("[WebSocket Hub Error] 确认事件失败: %v\n", err)
+	}
+}
 
-			fmt.Printf("[Redis] 收到消息: %s\n", msg.Text)
+// SendToDevice 发送临时消息给指定用户的某一个设备（不持久化）
+func (h *Hub) SendToDevice(userID uint, deviceID string, msgType string, data interface{}) {
+	msg := &Message{
+		UserID:   userID,
+		DeviceID: deviceID,
+		Type:     msgType,
+		Data:     data,
+	}
+	h.broadcast <- msg
+}
 
-			// 解析新格式：to-web:[user_id]:[msg_id] 回复内容
-			if len(msg.Text) < 7 || msg.Text[:7] != "to-web:" {
-				fmt.Printf("[Redis] 忽略非 to-web 消息\n")
-				continue
-			}
+// Devices 返回用户当前在线的设备ID
+func (h *Hub) Devices(userID uint) []string {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
 
-			// 分割 header 和 content
-			parts := strings.SplitN(msg.Text, " ", 2)
-			if len(parts) < 2 {
-				fmt.Printf("[Redis Error] 格式错误，缺少消息内容\n")
-				continue
-			}
+	devices := make([]string, 0, len(h.clients[userID]))
+	for client := range h.clients[userID] {
+		devices = append(devices, client.DeviceID)
+	}
+	return devices
+}
 
-			header := parts[0]      // "to-web:[user_id]:[msg_id]"
-			replyText := parts[1]   // "回复内容"
+// BroadcastToAll 广播消息给所有在线用户
+func (h *Hub) BroadcastToAll(msgType string, data interface{}) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
 
-			// 解析 header
-			headerParts := strings.Split(header, ":")
-			if len(headerParts) != 3 {
-				fmt.Printf("[Redis Error] Header 格式错误: %s\n", header)
-				continue
+	for userID, conns := range h.clients {
+		msg := &Message{
+			UserID: userID,
+			Type:   msgType,
+			Data:   data,
+		}
+		for client := range conns {
+			select {
+			case client.send <- msg:
+			default:
+				// 发送失败，跳过
 			}
-
-			userIDStr := headerParts[1]
-			msgID := headerParts[2]
-
-			// 解析 user_id
-			var userID uint
-			fmt.Sscanf(userIDStr, "%d", &userID)
-
-			fmt.Printf("[Redis] ✓ 推送给用户 %d, 消息ID: %s\n", userID, msgID)
-
-			// 只推送给指定用户（不再广播）
-			h.SendToUser(userID, "reply", map[string]interface{}{
-				"message_id":  msgID,
-				"reply":       replyText,
-				"timestamp":   msg.Timestamp,
-			})
 		}
 	}
 }
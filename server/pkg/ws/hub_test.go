@@ -0,0 +1,94 @@
+package ws
+
+import (
+	"errors"
+	"testing"
+)
+
+// memoryStore 测试用的事件存储
+type memoryStore struct {
+	events []*Message
+	calls  int
+}
+
+func (s *memoryStore) Append(msg *Message) error {
+	msg.ID = uint64(len(s.events) + 1)
+	s.events = append(s.events, msg)
+	return nil
+}
+
+func (s *memoryStore) Since(userID uint, afterID uint64, limit int) ([]*Message, error) {
+	s.calls++
+	var out []*Message
+	for _, msg := range s.events {
+		if msg.UserID == userID && msg.ID > afterID && len(out) < limit {
+			out = append(out, msg)
+		}
+	}
+	return out, nil
+}
+
+func (s *memoryStore) Ack(userID uint, id uint64) error { return nil }
+
+func TestHubReplay(t *testing.T) {
+	tests := []struct {
+		name      string
+		events    int
+		after     uint64
+		wantCount int
+		wantLast  uint64
+		wantCalls int
+	}{
+		{name: "nothing missed", events: 10, after: 10, wantCount: 0, wantLast: 10, wantCalls: 1},
+		{name: "single page", events: 10, after: 3, wantCount: 7, wantLast: 10, wantCalls: 1},
+		{name: "exact page", events: replayPageSize, after: 0, wantCount: replayPageSize, wantLast: replayPageSize, wantCalls: 2},
+		{name: "many pages", events: 2*replayPageSize + 50, after: 0, wantCount: 2*replayPageSize + 50, wantLast: 2*replayPageSize + 50, wantCalls: 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := &memoryStore{}
+			for i := 0; i < tt.events; i++ {
+				store.Append(&Message{UserID: 1, Type: "reply"})
+			}
+			hub := NewHub(store)
+
+			var got []uint64
+			last, err := hub.Replay(1, tt.after, func(msg *Message) error {
+				got = append(got, msg.ID)
+				return nil
+			})
+			if err != nil {
+				t.Fatalf("Replay: %v", err)
+			}
+			if len(got) != tt.wantCount || last != tt.wantLast || store.calls != tt.wantCalls {
+				t.Errorf("count = %d, last = %d, calls = %d; want %d, %d, %d",
+					len(got), last, store.calls, tt.wantCount, tt.wantLast, tt.wantCalls)
+			}
+			for i := 1; i < len(got); i++ {
+				if got[i] != got[i-1]+1 {
+					t.Fatalf("events out of order at %d: %d after %d", i, got[i], got[i-1])
+				}
+			}
+		})
+	}
+}
+
+func TestHubReplayStopsOnWriteError(t *testing.T) {
+	store := &memoryStore{}
+	for i := 0; i < 5; i++ {
+		store.Append(&Message{UserID: 1})
+	}
+	hub := NewHub(store)
+
+	broken := errors.New("connection closed")
+	last, err := hub.Replay(1, 0, func(msg *Message) error {
+		if msg.ID == 3 {
+			return broken
+		}
+		return nil
+	})
+	if !errors.Is(err, broken) || last != 2 {
+		t.Errorf("Replay = %d, %v; want 2, %v", last, err, broken)
+	}
+}
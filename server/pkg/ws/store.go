@@ -0,0 +1,112 @@
+package ws
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"talk-web/server/model"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// EventStore 持久化 Hub 事件，支持断线重连后补发
+type EventStore interface {
+	// Append 保存事件并分配该用户下一个序号
+	Append(msg *Message) error
+	// Since 返回序号大于 afterID 的事件（按序号升序），最多 limit 条
+	Since(userID uint, afterID uint64, limit int) ([]*Message, error)
+	// Ack 标记序号不大于 id 的事件已送达
+	Ack(userID uint, id uint64) error
+}
+
+// DBStore 基于数据库的事件存储
+type DBStore struct {
+	db *gorm.DB
+	mu sync.Mutex // 串行分配序号
+}
+
+func NewDBStore(db *gorm.DB) *DBStore {
+	return &DBStore{db: db}
+}
+
+func (s *DBStore) Append(msg *Message) error {
+	data, err := json.Marshal(msg.Data)
+	if err != nil {
+		return fmt.Errorf("marshal event data failed: %w", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var last uint64
+	if err := s.db.Model(&model.Event{}).
+		Where("user_id = ?", msg.UserID).
+		Select("COALESCE(MAX(seq), 0)").
+		Scan(&last).Error; err != nil {
+		return fmt.Errorf("query last seq failed: %w", err)
+	}
+
+	event := model.Event{
+		UserID: msg.UserID,
+		Seq:    last + 1,
+		Type:   msg.Type,
+		Data:   string(data),
+	}
+	if err := s.db.Create(&event).Error; err != nil {
+		return fmt.Errorf("save event failed: %w", err)
+	}
+
+	msg.ID = event.Seq
+	return nil
+}
+
+func (s *DBStore) Since(userID uint, afterID uint64, limit int) ([]*Message, error) {
+	var events []model.Event
+	if err := s.db.Where("user_id = ? AND seq > ?", userID, afterID).
+		Order("seq asc").
+		Limit(limit).
+		Find(&events).Error; err != nil {
+		return nil, fmt.Errorf("query events failed: %w", err)
+	}
+
+	messages := make([]*Message, 0, len(events))
+	for _, e := range events {
+		messages = append(messages, &Message{
+			ID:     e.Seq,
+			UserID: e.UserID,
+			Type:   e.Type,
+			Data:   json.RawMessage(e.Data),
+		})
+	}
+	return messages, nil
+}
+
+func (s *DBStore) Ack(userID uint, id uint64) error {
+	return s.db.Model(&model.Event{}).
+		Where("user_id = ? AND seq <= ? AND acked_at IS NULL", userID, id).
+		Update("acked_at", time.Now()).Error
+}
+
+// PruneAcked 定期清理已确认且超过保留期的事件，ctx 取消时退出
+func (s *DBStore) PruneAcked(ctx context.Context, retention time.Duration) {
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		cutoff := time.Now().Add(-retention)
+		// 保留每个用户的最后一条事件，保证序号不会回退
+		if err := s.db.Where("acked_at IS NOT NULL AND acked_at < ?", cutoff).
+			Where("seq < (SELECT MAX(e.seq) FROM events e WHERE e.user_id = events.user_id)").
+			Delete(&model.Event{}).Error; err != nil {
+			fmt.Printf("[Event Store Error] prune failed: %v\n", err)
+		}
+	}
+}
@@ -2,13 +2,20 @@ import { BrowserRouter, Routes, Route, Navigate } from 'react-router-dom'
 import Login from './pages/Login'
 import Talk from './pages/Talk'
 import Admin from './pages/Admin'
-import { isAuthenticated, isAdmin } from './utils/auth'
+import ChangePassword from './pages/ChangePassword'
+import LoginCallback from './pages/LoginCallback'
+import Security from './pages/Security'
+import Register from './pages/Register'
+import ResetPassword from './pages/ResetPassword'
+import { isAuthenticated, isAdmin, mustChangePassword } from './utils/auth'
 
 function PrivateRoute({ children }: { children: JSX.Element }) {
-  return isAuthenticated() ? children : <Navigate to="/login" />
+  if (!isAuthenticated()) return <Navigate to="/login" />
+  return mustChangePassword() ? <Navigate to="/change-password" /> : children
 }
 
 function AdminRoute({ children }: { children: JSX.Element }) {
+  if (mustChangePassword()) return <Navigate to="/change-password" />
   return isAuthenticated() && isAdmin() ? children : <Navigate to="/talk" />
 }
 
@@ -17,6 +24,13 @@ function App() {
     <BrowserRouter>
       <Routes>
         <Route path="/login" element={<Login />} />
+        <Route path="/login/callback" element={<LoginCallback />} />
+        <Route path="/register" element={<Register />} />
+        <Route path="/reset-password" element={<ResetPassword />} />
+        <Route
+          path="/change-password"
+          element={isAuthenticated() ? <ChangePassword /> : <Navigate to="/login" />}
+        />
         <Route
           path="/talk"
           element={
@@ -25,6 +39,14 @@ function App() {
             </PrivateRoute>
           }
         />
+        <Route
+          path="/security"
+          element={
+            <PrivateRoute>
+              <Security />
+            </PrivateRoute>
+          }
+        />
         <Route
           path="/admin"
           element={
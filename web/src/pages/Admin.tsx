@@ -7,25 +7,91 @@ interface User {
   id: number
   username: string
   is_admin: boolean
+  role: string
+  totp_enabled?: boolean
+  pending_approval?: boolean
   created_at: string
 }
 
+interface Invite {
+  id: number
+  prefix: string
+  role: string
+  max_uses: number
+  uses: number
+  require_approval: boolean
+  note: string
+  expires_at: string
+}
+
+const ROLE_LABELS: Record<string, string> = {
+  user: '普通用户',
+  operator: '运营',
+  admin: '管理员',
+}
+
 export default function Admin() {
   const [users, setUsers] = useState<User[]>([])
+  const [invites, setInvites] = useState<Invite[]>([])
+  const [inviteForm, setInviteForm] = useState({ role: 'user', max_uses: 1, require_approval: false, note: '' })
+  // 新生成的邀请链接，明文只显示这一次
+  const [inviteLink, setInviteLink] = useState('')
   const [loading, setLoading] = useState(true)
   const [showModal, setShowModal] = useState(false)
   const [editingUser, setEditingUser] = useState<User | null>(null)
   const [formData, setFormData] = useState({
     username: '',
     password: '',
-    is_admin: false,
+    role: 'user',
   })
   const navigate = useNavigate()
 
   useEffect(() => {
     loadUsers()
+    loadInvites()
   }, [])
 
+  const loadInvites = async () => {
+    try {
+      const response = await api.get('/admin/invites')
+      setInvites(response.data)
+    } catch (err) {
+      console.error('加载邀请码失败:', err)
+    }
+  }
+
+  const handleCreateInvite = async (e: React.FormEvent) => {
+    e.preventDefault()
+
+    try {
+      const response = await api.post('/admin/invites', inviteForm)
+      setInviteLink(`${window.location.origin}/register?code=${response.data.code}`)
+      loadInvites()
+    } catch (err: any) {
+      alert(err.response?.data?.error || '生成邀请码失败')
+    }
+  }
+
+  const handleRevokeInvite = async (id: number) => {
+    if (!confirm('确定撤销此邀请码吗？')) return
+
+    try {
+      await api.delete(`/admin/invites/${id}`)
+      loadInvites()
+    } catch (err: any) {
+      alert(err.response?.data?.error || '撤销失败')
+    }
+  }
+
+  const handleApprove = async (id: number) => {
+    try {
+      await api.post(`/admin/users/${id}/approve`)
+      loadUsers()
+    } catch (err: any) {
+      alert(err.response?.data?.error || '审核失败')
+    }
+  }
+
   const loadUsers = async () => {
     try {
       const response = await api.get('/admin/users')
@@ -39,13 +105,13 @@ export default function Admin() {
 
   const handleCreate = () => {
     setEditingUser(null)
-    setFormData({ username: '', password: '', is_admin: false })
+    setFormData({ username: '', password: '', role: 'user' })
     setShowModal(true)
   }
 
   const handleEdit = (user: User) => {
     setEditingUser(user)
-    setFormData({ username: user.username, password: '', is_admin: user.is_admin })
+    setFormData({ username: user.username, password: '', role: user.role })
     setShowModal(true)
   }
 
@@ -55,11 +121,12 @@ export default function Admin() {
     try {
       if (editingUser) {
         // 更新用户
-        const updateData: any = {}
-        if (formData.password) updateData.password = formData.password
-        updateData.is_admin = formData.is_admin
-
-        await api.put(`/admin/users/${editingUser.id}`, updateData)
+        if (formData.password) {
+          await api.put(`/admin/users/${editingUser.id}`, { password: formData.password })
+        }
+        if (formData.role !== editingUser.role) {
+          await api.put(`/admin/users/${editingUser.id}/role`, { role: formData.role })
+        }
       } else {
         // 创建用户
         await api.post('/admin/users', formData)
@@ -83,6 +150,36 @@ export default function Admin() {
     }
   }
 
+  const handlePasswordReset = async (user: User) => {
+    const email = prompt(`为 ${user.username} 生成重置密码链接。\n填写邮箱则通过邮件发送，留空则直接显示链接：`)
+    if (email === null) return
+
+    try {
+      const response = await api.post(`/admin/users/${user.id}/password-reset`, {
+        send_email: email !== '',
+        email,
+      })
+      if (response.data.sent) {
+        alert(`重置链接已发送到 ${response.data.email}`)
+      } else {
+        prompt('请把重置链接转交给用户（只显示这一次）：', response.data.reset_url)
+      }
+    } catch (err: any) {
+      alert(err.response?.data?.error || '生成重置链接失败')
+    }
+  }
+
+  const handleResetTwoFactor = async (user: User) => {
+    if (!confirm(`确定重置 ${user.username} 的两步验证吗？`)) return
+
+    try {
+      await api.delete(`/admin/users/${user.id}/2fa`)
+      loadUsers()
+    } catch (err: any) {
+      alert(err.response?.data?.error || '重置失败')
+    }
+  }
+
   if (loading) {
     return (
       <div className="min-h-screen flex items-center justify-center">
@@ -133,7 +230,7 @@ export default function Admin() {
                 <tr>
                   <th className="px-6 py-3 text-left text-xs font-medium text-gray-500 uppercase">ID</th>
                   <th className="px-6 py-3 text-left text-xs font-medium text-gray-500 uppercase">用户名</th>
-                  <th className="px-6 py-3 text-left text-xs font-medium text-gray-500 uppercase">管理员</th>
+                  <th className="px-6 py-3 text-left text-xs font-medium text-gray-500 uppercase">角色</th>
                   <th className="px-6 py-3 text-left text-xs font-medium text-gray-500 uppercase">创建时间</th>
                   <th className="px-6 py-3 text-left text-xs font-medium text-gray-500 uppercase">操作</th>
                 </tr>
@@ -144,22 +241,51 @@ export default function Admin() {
                     <td className="px-6 py-4 text-sm text-gray-900">{user.id}</td>
                     <td className="px-6 py-4 text-sm text-gray-900">{user.username}</td>
                     <td className="px-6 py-4 text-sm">
-                      {user.is_admin ? (
-                        <span className="px-2 py-1 bg-green-100 text-green-800 rounded-full text-xs">是</span>
-                      ) : (
-                        <span className="px-2 py-1 bg-gray-100 text-gray-800 rounded-full text-xs">否</span>
+                      <span
+                        className={`px-2 py-1 rounded-full text-xs ${
+                          user.role === 'user' ? 'bg-gray-100 text-gray-800' : 'bg-green-100 text-green-800'
+                        }`}
+                      >
+                        {ROLE_LABELS[user.role] || user.role}
+                      </span>
+                      {user.pending_approval && (
+                        <span className="ml-2 px-2 py-1 rounded-full text-xs bg-yellow-100 text-yellow-800">
+                          待审核
+                        </span>
                       )}
                     </td>
                     <td className="px-6 py-4 text-sm text-gray-500">
                       {new Date(user.created_at).toLocaleString('zh-CN')}
                     </td>
                     <td className="px-6 py-4 text-sm space-x-2">
+                      {user.pending_approval && (
+                        <button
+                          onClick={() => handleApprove(user.id)}
+                          className="text-green-600 hover:text-green-800"
+                        >
+                          批准
+                        </button>
+                      )}
                       <button
                         onClick={() => handleEdit(user)}
                         className="text-indigo-600 hover:text-indigo-800"
                       >
                         编辑
                       </button>
+                      <button
+                        onClick={() => handlePasswordReset(user)}
+                        className="text-indigo-600 hover:text-indigo-800"
+                      >
+                        重置密码
+                      </button>
+                      {user.totp_enabled && (
+                        <button
+                          onClick={() => handleResetTwoFactor(user)}
+                          className="text-yellow-600 hover:text-yellow-800"
+                        >
+                          重置两步验证
+                        </button>
+                      )}
                       <button
                         onClick={() => handleDelete(user.id)}
                         className="text-red-600 hover:text-red-800"
@@ -173,6 +299,96 @@ export default function Admin() {
             </table>
           </div>
         </div>
+
+        {/* 邀请码 */}
+        <div className="bg-white rounded-lg shadow mt-8">
+          <div className="p-6 border-b">
+            <h2 className="text-lg font-semibold text-gray-800">邀请注册</h2>
+          </div>
+
+          <form onSubmit={handleCreateInvite} className="p-6 flex flex-wrap gap-3 items-end border-b">
+            <div>
+              <label className="block text-sm font-medium text-gray-700 mb-1">角色</label>
+              <select
+                value={inviteForm.role}
+                onChange={(e) => setInviteForm({ ...inviteForm, role: e.target.value })}
+                className="px-3 py-2 border rounded-lg outline-none"
+              >
+                {Object.entries(ROLE_LABELS).map(([role, label]) => (
+                  <option key={role} value={role}>
+                    {label}
+                  </option>
+                ))}
+              </select>
+            </div>
+            <div>
+              <label className="block text-sm font-medium text-gray-700 mb-1">可用次数</label>
+              <input
+                type="number"
+                min={1}
+                value={inviteForm.max_uses}
+                onChange={(e) => setInviteForm({ ...inviteForm, max_uses: Number(e.target.value) })}
+                className="w-24 px-3 py-2 border rounded-lg outline-none"
+              />
+            </div>
+            <div className="flex-1">
+              <label className="block text-sm font-medium text-gray-700 mb-1">备注</label>
+              <input
+                type="text"
+                value={inviteForm.note}
+                onChange={(e) => setInviteForm({ ...inviteForm, note: e.target.value })}
+                className="w-full px-3 py-2 border rounded-lg outline-none"
+              />
+            </div>
+            <label className="flex items-center gap-2 text-sm text-gray-700 py-2">
+              <input
+                type="checkbox"
+                checked={inviteForm.require_approval}
+                onChange={(e) => setInviteForm({ ...inviteForm, require_approval: e.target.checked })}
+              />
+              需要审核
+            </label>
+            <button
+              type="submit"
+              className="px-4 py-2 bg-indigo-600 text-white rounded-lg hover:bg-indigo-700 transition"
+            >
+              生成邀请链接
+            </button>
+          </form>
+
+          {inviteLink && (
+            <div className="px-6 py-4 bg-yellow-50 text-sm text-yellow-800 break-all">
+              邀请链接（只显示这一次）：{inviteLink}
+            </div>
+          )}
+
+          <table className="w-full">
+            <tbody className="divide-y divide-gray-200">
+              {invites.map((invite) => (
+                <tr key={invite.id}>
+                  <td className="px-6 py-3 text-sm font-mono text-gray-900">{invite.prefix}…</td>
+                  <td className="px-6 py-3 text-sm text-gray-900">{ROLE_LABELS[invite.role] || invite.role}</td>
+                  <td className="px-6 py-3 text-sm text-gray-500">
+                    {invite.uses}/{invite.max_uses}
+                    {invite.require_approval && ' · 需审核'}
+                  </td>
+                  <td className="px-6 py-3 text-sm text-gray-500">{invite.note}</td>
+                  <td className="px-6 py-3 text-sm text-gray-500">
+                    {new Date(invite.expires_at).toLocaleString('zh-CN')} 过期
+                  </td>
+                  <td className="px-6 py-3 text-sm">
+                    <button
+                      onClick={() => handleRevokeInvite(invite.id)}
+                      className="text-red-600 hover:text-red-800"
+                    >
+                      撤销
+                    </button>
+                  </td>
+                </tr>
+              ))}
+            </tbody>
+          </table>
+        </div>
       </div>
 
       {/* 创建/编辑模态框 */}
@@ -212,17 +428,19 @@ export default function Admin() {
                 />
               </div>
 
-              <div className="flex items-center">
-                <input
-                  type="checkbox"
-                  id="is_admin"
-                  checked={formData.is_admin}
-                  onChange={(e) => setFormData({ ...formData, is_admin: e.target.checked })}
-                  className="w-4 h-4 text-indigo-600 border-gray-300 rounded focus:ring-indigo-500"
-                />
-                <label htmlFor="is_admin" className="ml-2 text-sm text-gray-700">
-                  管理员权限
-                </label>
+              <div>
+                <label className="block text-sm font-medium text-gray-700 mb-1">角色</label>
+                <select
+                  value={formData.role}
+                  onChange={(e) => setFormData({ ...formData, role: e.target.value })}
+                  className="w-full px-3 py-2 border rounded-lg focus:ring-2 focus:ring-indigo-500 outline-none"
+                >
+                  {Object.entries(ROLE_LABELS).map(([role, label]) => (
+                    <option key={role} value={role}>
+                      {label}
+                    </option>
+                  ))}
+                </select>
               </div>
 
               <div className="flex gap-3 pt-4">
@@ -0,0 +1,112 @@
+import { useState } from 'react'
+import { useNavigate } from 'react-router-dom'
+import api from '../utils/api'
+import { getUser, logout, setToken, setUser } from '../utils/auth'
+
+export default function ChangePassword() {
+  const [oldPassword, setOldPassword] = useState('')
+  const [newPassword, setNewPassword] = useState('')
+  const [confirmPassword, setConfirmPassword] = useState('')
+  const [error, setError] = useState('')
+  const [loading, setLoading] = useState(false)
+  const navigate = useNavigate()
+  const required = getUser()?.must_change_password
+
+  const handleSubmit = async (e: React.FormEvent) => {
+    e.preventDefault()
+    setError('')
+
+    if (newPassword !== confirmPassword) {
+      setError('两次输入的新密码不一致')
+      return
+    }
+
+    setLoading(true)
+    try {
+      const response = await api.post('/auth/change-password', {
+        old_password: oldPassword,
+        new_password: newPassword,
+      })
+      // 修改密码后旧的访问令牌失效，换用服务端为当前会话重新签发的令牌
+      setToken(response.data.token)
+      setUser(response.data.user)
+      navigate('/talk')
+    } catch (err: any) {
+      setError(err.response?.data?.error || '修改密码失败')
+    } finally {
+      setLoading(false)
+    }
+  }
+
+  const inputClass =
+    'w-full px-4 py-3 border border-gray-300 rounded-lg focus:ring-2 focus:ring-indigo-500 focus:border-transparent outline-none transition'
+
+  return (
+    <div className="min-h-screen bg-gradient-to-br from-blue-50 to-indigo-100 flex items-center justify-center p-4">
+      <div className="bg-white rounded-2xl shadow-xl p-8 w-full max-w-md">
+        <h1 className="text-3xl font-bold text-center text-gray-800 mb-4">修改密码</h1>
+        {required && (
+          <p className="text-center text-gray-600 mb-6">首次登录需要修改初始密码后才能继续使用</p>
+        )}
+
+        <form onSubmit={handleSubmit} className="space-y-6">
+          <div>
+            <label className="block text-sm font-medium text-gray-700 mb-2">原密码</label>
+            <input
+              type="password"
+              value={oldPassword}
+              onChange={(e) => setOldPassword(e.target.value)}
+              className={inputClass}
+              required
+            />
+          </div>
+
+          <div>
+            <label className="block text-sm font-medium text-gray-700 mb-2">新密码</label>
+            <input
+              type="password"
+              value={newPassword}
+              onChange={(e) => setNewPassword(e.target.value)}
+              className={inputClass}
+              placeholder="至少 8 位，包含字母和数字等多类字符"
+              required
+            />
+          </div>
+
+          <div>
+            <label className="block text-sm font-medium text-gray-700 mb-2">确认新密码</label>
+            <input
+              type="password"
+              value={confirmPassword}
+              onChange={(e) => setConfirmPassword(e.target.value)}
+              className={inputClass}
+              required
+            />
+          </div>
+
+          {error && (
+            <div className="bg-red-50 border border-red-200 text-red-700 px-4 py-3 rounded-lg">
+              {error}
+            </div>
+          )}
+
+          <button
+            type="submit"
+            disabled={loading}
+            className="w-full bg-indigo-600 hover:bg-indigo-700 disabled:bg-indigo-400 text-white font-semibold py-3 px-4 rounded-lg transition duration-200"
+          >
+            {loading ? '提交中...' : '修改密码'}
+          </button>
+
+          <button
+            type="button"
+            onClick={() => logout()}
+            className="w-full text-gray-500 hover:text-gray-700 text-sm"
+          >
+            退出登录
+          </button>
+        </form>
+      </div>
+    </div>
+  )
+}
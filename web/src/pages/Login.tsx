@@ -1,36 +1,69 @@
-import { useState } from 'react'
-import { useNavigate } from 'react-router-dom'
+import { useEffect, useState } from 'react'
+import { useLocation, useNavigate } from 'react-router-dom'
 import api from '../utils/api'
-import { setToken, setUser } from '../utils/auth'
+import { setRefreshToken, setToken, setUser } from '../utils/auth'
 
 export default function Login() {
   const [username, setUsername] = useState('')
   const [password, setPassword] = useState('')
-  const [error, setError] = useState('')
+  // 单点登录失败时服务端会带着 ?error= 跳转回来
+  const [error, setError] = useState(() => new URLSearchParams(window.location.search).get('error') || '')
   const [loading, setLoading] = useState(false)
+  const [ssoEnabled, setSsoEnabled] = useState(false)
+  const location = useLocation()
+  // 开启两步验证的用户密码通过后，需要再输入验证码；单点登录回来时直接进入这一步
+  const [challengeToken, setChallengeToken] = useState<string>(() => location.state?.challengeToken || '')
+  const [code, setCode] = useState('')
   const navigate = useNavigate()
 
+  useEffect(() => {
+    api
+      .get('/auth/oidc/config')
+      .then((response) => setSsoEnabled(response.data.enabled))
+      .catch(() => setSsoEnabled(false))
+  }, [])
+
   const handleSubmit = async (e: React.FormEvent) => {
     e.preventDefault()
     setError('')
     setLoading(true)
 
     try {
-      const response = await api.post('/auth/login', { username, password })
-      const { token, user } = response.data
+      const response = challengeToken
+        ? await api.post('/auth/login/2fa', { challenge_token: challengeToken, code })
+        : await api.post('/auth/login', { username, password })
+
+      if (response.data.two_factor_required) {
+        setChallengeToken(response.data.challenge_token)
+        return
+      }
+
+      const { token, refresh_token, user } = response.data
 
       setToken(token)
+      setRefreshToken(refresh_token)
       setUser(user)
 
-      // 跳转到主页
-      navigate('/talk')
+      // 需要修改初始密码时先跳转到改密页面
+      navigate(user.must_change_password ? '/change-password' : '/talk')
     } catch (err: any) {
       setError(err.response?.data?.error || '登录失败')
+      // 挑战令牌过期后回到第一步重新输入密码
+      if (challengeToken && err.response?.data?.error === '验证已过期，请重新登录') {
+        setChallengeToken('')
+        setCode('')
+      }
     } finally {
       setLoading(false)
     }
   }
 
+  const handleBack = () => {
+    setChallengeToken('')
+    setCode('')
+    setError('')
+  }
+
   return (
     <div className="min-h-screen bg-gradient-to-br from-blue-50 to-indigo-100 flex items-center justify-center p-4">
       <div className="bg-white rounded-2xl shadow-xl p-8 w-full max-w-md">
@@ -39,33 +72,53 @@ export default function Login() {
         </h1>
 
         <form onSubmit={handleSubmit} className="space-y-6">
-          <div>
-            <label className="block text-sm font-medium text-gray-700 mb-2">
-              用户名
-            </label>
-            <input
-              type="text"
-              value={username}
-              onChange={(e) => setUsername(e.target.value)}
-              className="w-full px-4 py-3 border border-gray-300 rounded-lg focus:ring-2 focus:ring-indigo-500 focus:border-transparent outline-none transition"
-              placeholder="请输入用户名"
-              required
-            />
-          </div>
-
-          <div>
-            <label className="block text-sm font-medium text-gray-700 mb-2">
-              密码
-            </label>
-            <input
-              type="password"
-              value={password}
-              onChange={(e) => setPassword(e.target.value)}
-              className="w-full px-4 py-3 border border-gray-300 rounded-lg focus:ring-2 focus:ring-indigo-500 focus:border-transparent outline-none transition"
-              placeholder="请输入密码"
-              required
-            />
-          </div>
+          {challengeToken ? (
+            <div>
+              <label className="block text-sm font-medium text-gray-700 mb-2">
+                验证码
+              </label>
+              <input
+                type="text"
+                value={code}
+                onChange={(e) => setCode(e.target.value)}
+                className="w-full px-4 py-3 border border-gray-300 rounded-lg focus:ring-2 focus:ring-indigo-500 focus:border-transparent outline-none transition"
+                placeholder="验证器 App 中的 6 位数字或恢复码"
+                autoComplete="one-time-code"
+                autoFocus
+                required
+              />
+            </div>
+          ) : (
+            <>
+              <div>
+                <label className="block text-sm font-medium text-gray-700 mb-2">
+                  用户名
+                </label>
+                <input
+                  type="text"
+                  value={username}
+                  onChange={(e) => setUsername(e.target.value)}
+                  className="w-full px-4 py-3 border border-gray-300 rounded-lg focus:ring-2 focus:ring-indigo-500 focus:border-transparent outline-none transition"
+                  placeholder="请输入用户名"
+                  required
+                />
+              </div>
+
+              <div>
+                <label className="block text-sm font-medium text-gray-700 mb-2">
+                  密码
+                </label>
+                <input
+                  type="password"
+                  value={password}
+                  onChange={(e) => setPassword(e.target.value)}
+                  className="w-full px-4 py-3 border border-gray-300 rounded-lg focus:ring-2 focus:ring-indigo-500 focus:border-transparent outline-none transition"
+                  placeholder="请输入密码"
+                  required
+                />
+              </div>
+            </>
+          )}
 
           {error && (
             <div className="bg-red-50 border border-red-200 text-red-700 px-4 py-3 rounded-lg">
@@ -78,9 +131,39 @@ export default function Login() {
             disabled={loading}
             className="w-full bg-indigo-600 hover:bg-indigo-700 disabled:bg-indigo-400 text-white font-semibold py-3 px-4 rounded-lg transition duration-200"
           >
-            {loading ? '登录中...' : '登录'}
+            {loading ? '登录中...' : challengeToken ? '验证' : '登录'}
           </button>
+
+          {challengeToken && (
+            <button
+              type="button"
+              onClick={handleBack}
+              className="w-full text-sm text-gray-500 hover:text-gray-700"
+            >
+              返回重新输入密码
+            </button>
+          )}
         </form>
+
+        {!challengeToken && (
+          <button
+            type="button"
+            onClick={() => navigate('/register')}
+            className="w-full mt-4 text-sm text-gray-500 hover:text-gray-700"
+          >
+            有邀请码？注册账号
+          </button>
+        )}
+
+        {ssoEnabled && !challengeToken && (
+          <button
+            type="button"
+            onClick={() => (window.location.href = '/api/auth/oidc/login')}
+            className="w-full mt-4 border border-indigo-600 text-indigo-600 hover:bg-indigo-50 font-semibold py-3 px-4 rounded-lg transition duration-200"
+          >
+            使用单点登录
+          </button>
+        )}
       </div>
     </div>
   )
@@ -0,0 +1,61 @@
+import { useEffect, useState } from 'react'
+import { useNavigate } from 'react-router-dom'
+import api from '../utils/api'
+import { setRefreshToken, setToken, setUser } from '../utils/auth'
+
+// 单点登录回调：服务端把令牌放在 URL fragment 中跳转到这里
+export default function LoginCallback() {
+  const [error, setError] = useState('')
+  const navigate = useNavigate()
+
+  useEffect(() => {
+    const params = new URLSearchParams(window.location.hash.slice(1))
+    const token = params.get('token')
+    const refreshToken = params.get('refresh_token')
+
+    // 立即清掉地址栏里的令牌
+    window.history.replaceState(null, '', window.location.pathname)
+
+    // 开启了两步验证：回到登录页输入验证码
+    const challengeToken = params.get('challenge_token')
+    if (challengeToken) {
+      navigate('/login', { replace: true, state: { challengeToken } })
+      return
+    }
+
+    if (!token || !refreshToken) {
+      setError('登录结果无效，请重新登录')
+      return
+    }
+
+    setToken(token)
+    setRefreshToken(refreshToken)
+    api
+      .get('/auth/me')
+      .then((response) => {
+        setUser(response.data)
+        navigate(response.data.must_change_password ? '/change-password' : '/talk', { replace: true })
+      })
+      .catch(() => setError('获取用户信息失败，请重新登录'))
+  }, [navigate])
+
+  return (
+    <div className="min-h-screen bg-gradient-to-br from-blue-50 to-indigo-100 flex items-center justify-center p-4">
+      <div className="bg-white rounded-2xl shadow-xl p-8 w-full max-w-md text-center">
+        {error ? (
+          <>
+            <div className="bg-red-50 border border-red-200 text-red-700 px-4 py-3 rounded-lg mb-6">{error}</div>
+            <button
+              onClick={() => navigate('/login', { replace: true })}
+              className="w-full bg-indigo-600 hover:bg-indigo-700 text-white font-semibold py-3 px-4 rounded-lg transition duration-200"
+            >
+              返回登录
+            </button>
+          </>
+        ) : (
+          <div className="text-xl text-gray-600">登录中...</div>
+        )}
+      </div>
+    </div>
+  )
+}
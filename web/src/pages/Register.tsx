@@ -0,0 +1,125 @@
+import { useState } from 'react'
+import { Link } from 'react-router-dom'
+import api from '../utils/api'
+
+export default function Register() {
+  // 邀请链接形如 /register?code=inv_xxx
+  const [inviteCode, setInviteCode] = useState(() => new URLSearchParams(window.location.search).get('code') || '')
+  const [username, setUsername] = useState('')
+  const [password, setPassword] = useState('')
+  const [confirmPassword, setConfirmPassword] = useState('')
+  const [error, setError] = useState('')
+  const [message, setMessage] = useState('')
+  const [loading, setLoading] = useState(false)
+
+  const handleSubmit = async (e: React.FormEvent) => {
+    e.preventDefault()
+    setError('')
+
+    if (password !== confirmPassword) {
+      setError('两次输入的密码不一致')
+      return
+    }
+
+    setLoading(true)
+    try {
+      const response = await api.post('/auth/register', {
+        invite_code: inviteCode,
+        username,
+        password,
+      })
+      setMessage(response.data.message)
+    } catch (err: any) {
+      setError(err.response?.data?.error || '注册失败')
+    } finally {
+      setLoading(false)
+    }
+  }
+
+  const inputClass =
+    'w-full px-4 py-3 border border-gray-300 rounded-lg focus:ring-2 focus:ring-indigo-500 focus:border-transparent outline-none transition'
+
+  return (
+    <div className="min-h-screen bg-gradient-to-br from-blue-50 to-indigo-100 flex items-center justify-center p-4">
+      <div className="bg-white rounded-2xl shadow-xl p-8 w-full max-w-md">
+        <h1 className="text-3xl font-bold text-center text-gray-800 mb-8">注册账号</h1>
+
+        {message ? (
+          <div className="space-y-6">
+            <div className="bg-green-50 border border-green-200 text-green-700 px-4 py-3 rounded-lg">
+              {message}
+            </div>
+            <Link to="/login" className="block text-center text-indigo-600 hover:text-indigo-800">
+              前往登录
+            </Link>
+          </div>
+        ) : (
+          <form onSubmit={handleSubmit} className="space-y-6">
+            <div>
+              <label className="block text-sm font-medium text-gray-700 mb-2">邀请码</label>
+              <input
+                type="text"
+                value={inviteCode}
+                onChange={(e) => setInviteCode(e.target.value)}
+                className={inputClass}
+                required
+              />
+            </div>
+
+            <div>
+              <label className="block text-sm font-medium text-gray-700 mb-2">用户名</label>
+              <input
+                type="text"
+                value={username}
+                onChange={(e) => setUsername(e.target.value)}
+                className={inputClass}
+                required
+              />
+            </div>
+
+            <div>
+              <label className="block text-sm font-medium text-gray-700 mb-2">密码</label>
+              <input
+                type="password"
+                value={password}
+                onChange={(e) => setPassword(e.target.value)}
+                className={inputClass}
+                placeholder="至少 8 位，包含字母和数字等多类字符"
+                required
+              />
+            </div>
+
+            <div>
+              <label className="block text-sm font-medium text-gray-700 mb-2">确认密码</label>
+              <input
+                type="password"
+                value={confirmPassword}
+                onChange={(e) => setConfirmPassword(e.target.value)}
+                className={inputClass}
+                required
+              />
+            </div>
+
+            {error && (
+              <div className="bg-red-50 border border-red-200 text-red-700 px-4 py-3 rounded-lg">
+                {error}
+              </div>
+            )}
+
+            <button
+              type="submit"
+              disabled={loading}
+              className="w-full bg-indigo-600 hover:bg-indigo-700 disabled:bg-indigo-400 text-white font-semibold py-3 px-4 rounded-lg transition duration-200"
+            >
+              {loading ? '注册中...' : '注册'}
+            </button>
+
+            <Link to="/login" className="block text-center text-sm text-gray-500 hover:text-gray-700">
+              已有账号？去登录
+            </Link>
+          </form>
+        )}
+      </div>
+    </div>
+  )
+}
@@ -0,0 +1,94 @@
+import { useState } from 'react'
+import { Link } from 'react-router-dom'
+import api from '../utils/api'
+
+export default function ResetPassword() {
+  // 重置链接形如 /reset-password?token=xxx
+  const token = new URLSearchParams(window.location.search).get('token') || ''
+  const [newPassword, setNewPassword] = useState('')
+  const [confirmPassword, setConfirmPassword] = useState('')
+  const [error, setError] = useState(token ? '' : '重置链接无效')
+  const [message, setMessage] = useState('')
+  const [loading, setLoading] = useState(false)
+
+  const handleSubmit = async (e: React.FormEvent) => {
+    e.preventDefault()
+    setError('')
+
+    if (newPassword !== confirmPassword) {
+      setError('两次输入的新密码不一致')
+      return
+    }
+
+    setLoading(true)
+    try {
+      const response = await api.post('/auth/password-reset', { token, new_password: newPassword })
+      setMessage(response.data.message)
+    } catch (err: any) {
+      setError(err.response?.data?.error || '重置密码失败')
+    } finally {
+      setLoading(false)
+    }
+  }
+
+  const inputClass =
+    'w-full px-4 py-3 border border-gray-300 rounded-lg focus:ring-2 focus:ring-indigo-500 focus:border-transparent outline-none transition'
+
+  return (
+    <div className="min-h-screen bg-gradient-to-br from-blue-50 to-indigo-100 flex items-center justify-center p-4">
+      <div className="bg-white rounded-2xl shadow-xl p-8 w-full max-w-md">
+        <h1 className="text-3xl font-bold text-center text-gray-800 mb-8">重置密码</h1>
+
+        {message ? (
+          <div className="space-y-6">
+            <div className="bg-green-50 border border-green-200 text-green-700 px-4 py-3 rounded-lg">
+              {message}
+            </div>
+            <Link to="/login" className="block text-center text-indigo-600 hover:text-indigo-800">
+              前往登录
+            </Link>
+          </div>
+        ) : (
+          <form onSubmit={handleSubmit} className="space-y-6">
+            <div>
+              <label className="block text-sm font-medium text-gray-700 mb-2">新密码</label>
+              <input
+                type="password"
+                value={newPassword}
+                onChange={(e) => setNewPassword(e.target.value)}
+                className={inputClass}
+                placeholder="至少 8 位，包含字母和数字等多类字符"
+                required
+              />
+            </div>
+
+            <div>
+              <label className="block text-sm font-medium text-gray-700 mb-2">确认新密码</label>
+              <input
+                type="password"
+                value={confirmPassword}
+                onChange={(e) => setConfirmPassword(e.target.value)}
+                className={inputClass}
+                required
+              />
+            </div>
+
+            {error && (
+              <div className="bg-red-50 border border-red-200 text-red-700 px-4 py-3 rounded-lg">
+                {error}
+              </div>
+            )}
+
+            <button
+              type="submit"
+              disabled={loading || !token}
+              className="w-full bg-indigo-600 hover:bg-indigo-700 disabled:bg-indigo-400 text-white font-semibold py-3 px-4 rounded-lg transition duration-200"
+            >
+              {loading ? '提交中...' : '设置新密码'}
+            </button>
+          </form>
+        )}
+      </div>
+    </div>
+  )
+}
@@ -0,0 +1,216 @@
+import { useEffect, useState } from 'react'
+import { useNavigate } from 'react-router-dom'
+import api from '../utils/api'
+
+interface TwoFactorStatus {
+  enabled: boolean
+  recovery_codes_remaining: number
+}
+
+export default function Security() {
+  const [status, setStatus] = useState<TwoFactorStatus | null>(null)
+  const [password, setPassword] = useState('')
+  const [code, setCode] = useState('')
+  // 生成密钥后、确认绑定前的密钥和 otpauth:// 链接
+  const [setup, setSetup] = useState<{ secret: string; uri: string } | null>(null)
+  // 恢复码只在生成时显示一次
+  const [recoveryCodes, setRecoveryCodes] = useState<string[]>([])
+  const [error, setError] = useState('')
+  const [loading, setLoading] = useState(false)
+  const navigate = useNavigate()
+
+  const loadStatus = async () => {
+    try {
+      const response = await api.get('/auth/2fa')
+      setStatus(response.data)
+    } catch (err: any) {
+      setError(err.response?.data?.error || '加载两步验证状态失败')
+    }
+  }
+
+  useEffect(() => {
+    loadStatus()
+  }, [])
+
+  const run = async (action: () => Promise<void>) => {
+    setError('')
+    setLoading(true)
+    try {
+      await action()
+    } catch (err: any) {
+      setError(err.response?.data?.error || '操作失败')
+    } finally {
+      setLoading(false)
+    }
+  }
+
+  const handleSetup = (e: React.FormEvent) => {
+    e.preventDefault()
+    run(async () => {
+      const response = await api.post('/auth/2fa/setup', { password })
+      setSetup(response.data)
+      setPassword('')
+    })
+  }
+
+  const handleEnable = (e: React.FormEvent) => {
+    e.preventDefault()
+    run(async () => {
+      const response = await api.post('/auth/2fa/enable', { code })
+      setRecoveryCodes(response.data.recovery_codes)
+      setSetup(null)
+      setCode('')
+      await loadStatus()
+    })
+  }
+
+  const handleDisable = (e: React.FormEvent) => {
+    e.preventDefault()
+    if (!confirm('确定关闭两步验证吗？')) return
+    run(async () => {
+      await api.post('/auth/2fa/disable', { password, code })
+      setRecoveryCodes([])
+      setPassword('')
+      setCode('')
+      await loadStatus()
+    })
+  }
+
+  const handleRegenerate = () => {
+    if (!code) {
+      setError('请先输入验证码')
+      return
+    }
+    run(async () => {
+      const response = await api.post('/auth/2fa/recovery-codes', { code })
+      setRecoveryCodes(response.data.recovery_codes)
+      setCode('')
+      await loadStatus()
+    })
+  }
+
+  const inputClass =
+    'w-full px-4 py-3 border border-gray-300 rounded-lg focus:ring-2 focus:ring-indigo-500 focus:border-transparent outline-none transition'
+  const buttonClass =
+    'w-full bg-indigo-600 hover:bg-indigo-700 disabled:bg-indigo-400 text-white font-semibold py-3 px-4 rounded-lg transition duration-200'
+
+  return (
+    <div className="min-h-screen bg-gradient-to-br from-blue-50 to-indigo-100 flex items-center justify-center p-4">
+      <div className="bg-white rounded-2xl shadow-xl p-8 w-full max-w-md space-y-6">
+        <h1 className="text-3xl font-bold text-center text-gray-800">两步验证</h1>
+
+        {status && (
+          <p className="text-center text-gray-600">
+            {status.enabled
+              ? `已开启，剩余 ${status.recovery_codes_remaining} 个恢复码`
+              : '未开启，开启后登录时需要输入验证器 App 中的验证码'}
+          </p>
+        )}
+
+        {recoveryCodes.length > 0 && (
+          <div className="bg-yellow-50 border border-yellow-200 px-4 py-3 rounded-lg">
+            <p className="text-sm text-yellow-800 mb-2">
+              请妥善保存以下恢复码，每个只能使用一次，离开本页面后将无法再次查看：
+            </p>
+            <div className="grid grid-cols-2 gap-2 font-mono text-sm">
+              {recoveryCodes.map((c) => (
+                <span key={c}>{c}</span>
+              ))}
+            </div>
+          </div>
+        )}
+
+        {status && !status.enabled && !setup && (
+          <form onSubmit={handleSetup} className="space-y-4">
+            <input
+              type="password"
+              value={password}
+              onChange={(e) => setPassword(e.target.value)}
+              className={inputClass}
+              placeholder="请输入当前密码"
+              required
+            />
+            <button type="submit" disabled={loading} className={buttonClass}>
+              开始设置
+            </button>
+          </form>
+        )}
+
+        {setup && (
+          <form onSubmit={handleEnable} className="space-y-4">
+            <p className="text-sm text-gray-600">
+              在验证器 App 中添加账户：打开下面的链接，或手动输入密钥。
+            </p>
+            <a href={setup.uri} className="block text-sm text-indigo-600 break-all">
+              {setup.uri}
+            </a>
+            <p className="font-mono text-center bg-gray-50 py-2 rounded break-all">{setup.secret}</p>
+            <input
+              type="text"
+              value={code}
+              onChange={(e) => setCode(e.target.value)}
+              className={inputClass}
+              placeholder="输入 App 中显示的 6 位验证码"
+              autoComplete="one-time-code"
+              required
+            />
+            <button type="submit" disabled={loading} className={buttonClass}>
+              确认开启
+            </button>
+          </form>
+        )}
+
+        {status?.enabled && (
+          <form onSubmit={handleDisable} className="space-y-4">
+            <input
+              type="text"
+              value={code}
+              onChange={(e) => setCode(e.target.value)}
+              className={inputClass}
+              placeholder="验证码或恢复码"
+              autoComplete="one-time-code"
+              required
+            />
+            <button
+              type="button"
+              onClick={handleRegenerate}
+              disabled={loading}
+              className="w-full border border-indigo-600 text-indigo-600 hover:bg-indigo-50 font-semibold py-3 px-4 rounded-lg transition duration-200"
+            >
+              重新生成恢复码
+            </button>
+            <input
+              type="password"
+              value={password}
+              onChange={(e) => setPassword(e.target.value)}
+              className={inputClass}
+              placeholder="关闭时需要输入当前密码"
+              required
+            />
+            <button
+              type="submit"
+              disabled={loading}
+              className="w-full bg-red-600 hover:bg-red-700 disabled:bg-red-400 text-white font-semibold py-3 px-4 rounded-lg transition duration-200"
+            >
+              关闭两步验证
+            </button>
+          </form>
+        )}
+
+        {error && (
+          <div className="bg-red-50 border border-red-200 text-red-700 px-4 py-3 rounded-lg">
+            {error}
+          </div>
+        )}
+
+        <button
+          type="button"
+          onClick={() => navigate('/talk')}
+          className="w-full text-sm text-gray-500 hover:text-gray-700"
+        >
+          返回主页
+        </button>
+      </div>
+    </div>
+  )
+}
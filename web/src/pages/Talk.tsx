@@ -1,13 +1,14 @@
 import { useState, useRef, useEffect } from 'react'
 import { useNavigate } from 'react-router-dom'
-import api from '../utils/api'
-import { getUser, logout, isAdmin } from '../utils/auth'
+import api, { refreshAccessToken } from '../utils/api'
+import { getUser, logout, isAdmin, isTokenExpired } from '../utils/auth'
 
 interface HistoryMessage {
   id: number
   text: string
   reply: string
   status: string
+  delivery_status?: string
   sent_at: string
   replied_at?: string
 }
@@ -19,13 +20,16 @@ export default function Talk() {
   const [_micPermission, setMicPermission] = useState<'prompt' | 'granted' | 'denied'>('prompt')
   const [history, setHistory] = useState<HistoryMessage[]>([])
   const [wsConnected, setWsConnected] = useState(false)
+  const [textInput, setTextInput] = useState('')
   const mediaRecorderRef = useRef<MediaRecorder | null>(null)
   const streamRef = useRef<MediaStream | null>(null)
   const chunksRef = useRef<Blob[]>([])
+  const streamingMsgIdRef = useRef<string | null>(null) // 正在通过 WebSocket 流式识别的消息ID
   const recordingStartTimeRef = useRef<number>(0)
   const wsRef = useRef<WebSocket | null>(null)
   const wsReconnectTimerRef = useRef<number | null>(null)
   const wsReconnectAttemptsRef = useRef<number>(0)
+  const lastEventIdRef = useRef<number>(0) // 已收到的最大事件序号，重连时用于补发
   const navigate = useNavigate()
   const user = getUser()
 
@@ -36,7 +40,7 @@ export default function Talk() {
   // 加载历史记录
   const loadHistory = async (playLatestAudio = false) => {
     try {
-      const response = await api.get('/history')
+      const response = await api.get('/history', { params: { limit: 3 } })
       const messages = response.data.messages || []
       setHistory(messages)
 
@@ -54,10 +58,20 @@ export default function Talk() {
   }
 
   // 建立 WebSocket 连接（带重连策略）
-  const connectWebSocket = () => {
-    const token = localStorage.getItem('token')
+  const connectWebSocket = async () => {
+    let token = localStorage.getItem('token')
     if (!token) return
 
+    // 访问令牌有效期很短，过期时先刷新再连接
+    if (isTokenExpired(token)) {
+      try {
+        token = await refreshAccessToken()
+      } catch {
+        logout()
+        return
+      }
+    }
+
     // 清除之前的重连定时器
     if (wsReconnectTimerRef.current) {
       clearTimeout(wsReconnectTimerRef.current)
@@ -66,7 +80,16 @@ export default function Talk() {
 
     // 使用当前页面的 host（适配开发和生产环境）
     const protocol = window.location.protocol === 'https:' ? 'wss:' : 'ws:'
-    const wsUrl = `${protocol}//${window.location.host}/api/ws?token=${token}`
+    // 每个标签页一个设备标识（sessionStorage 不在标签页间共享），重连时保持不变
+    let deviceId = sessionStorage.getItem('device_id')
+    if (!deviceId) {
+      deviceId = Math.random().toString(36).slice(2, 10)
+      sessionStorage.setItem('device_id', deviceId)
+    }
+    let wsUrl = `${protocol}//${window.location.host}/api/ws?token=${token}&device_id=${deviceId}`
+    if (lastEventIdRef.current > 0) {
+      wsUrl += `&last_event_id=${lastEventIdRef.current}`
+    }
 
     console.log('连接 WebSocket:', wsUrl, `(尝试 ${wsReconnectAttemptsRef.current + 1})`)
     const ws = new WebSocket(wsUrl)
@@ -82,7 +105,37 @@ export default function Talk() {
         const data = JSON.parse(event.data)
         console.log('收到 WebSocket 消息:', data)
 
-        if (data.type === 'reply') {
+        // 持久化事件带有序号：跳过重复的，并向服务端确认
+        if (data.id) {
+          if (data.id <= lastEventIdRef.current) return
+          lastEventIdRef.current = data.id
+          ws.send(JSON.stringify({ type: 'ack', id: data.id }))
+        }
+
+        // 令牌已被管理员注销（改密码、降权或删除账号）
+        if (data.type === 'status' && data.data?.event === 'revoked') {
+          logout()
+          return
+        }
+
+        if (data.type === 'broadcast') {
+          showMessage(`📢 ${data.data.text}`, 'success')
+        } else if (data.type === 'partial_transcript') {
+          setMessage(`🎙️ ${data.data.text}`)
+          setMessageType('success')
+        } else if (data.type === 'transcript') {
+          showMessage(`✓ ${data.data.text} (等待回复...)`, 'success')
+        } else if (data.type === 'error' && data.data?.message_id) {
+          showMessage(`❌ ${data.data.detail || data.data.error}`, 'error')
+        } else if (data.type === 'delivery') {
+          if (data.data.delivery_status === 'failed') {
+            showMessage(`❌ ${data.data.error || '发送失败'}`, 'error')
+          }
+          loadHistory()
+        } else if (data.type === 'reply_timeout') {
+          showMessage('⏱️ 等待回复超时', 'error')
+          loadHistory()
+        } else if (data.type === 'reply') {
           const { reply, reply_audio } = data.data
 
           // 显示回复
@@ -215,21 +268,47 @@ export default function Talk() {
       mediaRecorderRef.current = mediaRecorder
       chunksRef.current = []
 
+      // WebSocket 已连接时边录边传，服务端实时返回中间识别结果
+      const ws = wsRef.current
+      const streaming = ws !== null && ws.readyState === WebSocket.OPEN
+      streamingMsgIdRef.current = null
+      if (ws && streaming) {
+        const msgId = newMessageId()
+        streamingMsgIdRef.current = msgId
+        ws.send(JSON.stringify({ type: 'start_utterance', msg_id: msgId, format: 'webm' }))
+      }
+
       mediaRecorder.ondataavailable = (e) => {
         if (e.data.size > 0) {
           chunksRef.current.push(e.data)
+          if (ws && streaming && ws.readyState === WebSocket.OPEN) {
+            ws.send(e.data)
+          }
         }
       }
 
       mediaRecorder.onstop = async () => {
         const recordingDuration = Date.now() - recordingStartTimeRef.current
 
+        const streamingMsgId = streamingMsgIdRef.current
+        streamingMsgIdRef.current = null
+
         // 检查录音时长
         if (recordingDuration < MIN_RECORDING_TIME) {
+          if (streamingMsgId) {
+            wsRef.current?.send(JSON.stringify({ type: 'cancel_utterance' }))
+          }
           showMessage('录音时间太短，请按住至少1秒', 'error')
           return
         }
 
+        // 流式识别：通知服务端录音结束，最终结果通过 WebSocket 推送
+        if (streamingMsgId && wsRef.current?.readyState === WebSocket.OPEN) {
+          wsRef.current.send(JSON.stringify({ type: 'end_utterance' }))
+          showMessage('识别中...', 'success')
+          return
+        }
+
         // 等待一下确保数据收集完成
         await new Promise(resolve => setTimeout(resolve, 100))
 
@@ -284,8 +363,7 @@ export default function Talk() {
   }
 
   const uploadAudio = async (audioBlob: Blob) => {
-    // 生成唯一消息ID (timestamp + random)
-    const msgId = `${Date.now()}-${Math.random().toString(36).substr(2, 9)}`
+    const msgId = newMessageId()
     console.log('📤 [上传] 生成消息ID:', msgId)
 
     const formData = new FormData()
@@ -323,6 +401,29 @@ export default function Talk() {
     }
   }
 
+  // 发送文字消息（不经过语音识别）
+  const sendText = async (e: React.FormEvent) => {
+    e.preventDefault()
+    const text = textInput.trim()
+    if (!text) return
+
+    try {
+      await api.post('/messages', { msg_id: newMessageId(), text })
+      setTextInput('')
+      showMessage(`✓ ${text} (等待回复...)`, 'success')
+      loadHistory()
+      if (!wsConnected) {
+        pollForReply()
+      }
+    } catch (err: any) {
+      const errorMsg = err.response?.data?.detail || err.response?.data?.error || err.message || '发送失败'
+      showMessage(`❌ ${errorMsg}`, 'error')
+    }
+  }
+
+  // 生成唯一消息ID (timestamp + random)
+  const newMessageId = () => `${Date.now()}-${Math.random().toString(36).substr(2, 9)}`
+
   const pollForReply = async () => {
     const maxAttempts = 60 // 最多轮询 60 次（60秒）
     let attempts = 0
@@ -383,7 +484,10 @@ export default function Talk() {
       console.log('🔊 [播放音频] 开始:', audioUrl)
 
       // 使用 fetch 下载音频（audioUrl 已包含 /api 前缀）
-      const token = localStorage.getItem('token')
+      let token = localStorage.getItem('token')
+      if (token && isTokenExpired(token)) {
+        token = await refreshAccessToken()
+      }
 
       console.log('📥 [播放音频] 下载中...')
       const response = await fetch(audioUrl, {
@@ -453,6 +557,12 @@ export default function Talk() {
                 管理后台
               </button>
             )}
+            <button
+              onClick={() => navigate('/security')}
+              className="px-4 py-2 bg-white border text-gray-700 rounded-lg hover:bg-gray-50 transition"
+            >
+              安全设置
+            </button>
             <button
               onClick={logout}
               className="px-4 py-2 bg-gray-600 text-white rounded-lg hover:bg-gray-700 transition"
@@ -490,6 +600,24 @@ export default function Talk() {
             </button>
           </div>
 
+          {/* 文字输入（不方便说话时使用） */}
+          <form onSubmit={sendText} className="flex gap-2 mb-8">
+            <input
+              type="text"
+              value={textInput}
+              onChange={(e) => setTextInput(e.target.value)}
+              placeholder="或者输入文字..."
+              className="flex-1 px-4 py-2 border border-gray-300 rounded-lg focus:outline-none focus:ring-2 focus:ring-indigo-500"
+            />
+            <button
+              type="submit"
+              disabled={!textInput.trim()}
+              className="px-4 py-2 bg-indigo-600 text-white rounded-lg hover:bg-indigo-700 transition disabled:opacity-50"
+            >
+              发送
+            </button>
+          </form>
+
           {/* 提示信息 */}
           <div className="text-center text-gray-600 space-y-2">
             <p>🖱️ 鼠标按住录音（至少1秒），松开发送</p>
@@ -528,8 +656,13 @@ export default function Talk() {
                       <p className="text-gray-700">{msg.reply}</p>
                     </div>
                   )}
-                  {!msg.reply && msg.status !== 'timeout' && (
-                    <p className="text-gray-400 text-sm mt-2">⏳ 等待回复...</p>
+                  {!msg.reply && msg.status === 'sent' && (
+                    <p className="text-gray-400 text-sm mt-2">
+                      {msg.delivery_status === 'queued' ? '📤 发送中...' : '⏳ 等待回复...'}
+                    </p>
+                  )}
+                  {msg.status === 'failed' && !msg.reply && (
+                    <p className="text-red-400 text-sm mt-2">❌ 发送失败</p>
                   )}
                   {msg.status === 'timeout' && !msg.reply && (
                     <p className="text-red-400 text-sm mt-2">⏱️ 回复超时</p>
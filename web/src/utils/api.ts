@@ -1,4 +1,5 @@
 import axios from 'axios'
+import { getRefreshToken, setRefreshToken, setToken } from './auth'
 
 const api = axios.create({
   baseURL: '/api',
@@ -17,12 +18,59 @@ api.interceptors.request.use(
   (error) => Promise.reject(error)
 )
 
-// 响应拦截器 - 处理401
+// 正在进行的刷新请求（并发的 401 共用一次刷新）
+let refreshing: Promise<string> | null = null
+
+// 用 refresh token 换取新的访问令牌
+export const refreshAccessToken = (): Promise<string> => {
+  if (!refreshing) {
+    const refreshToken = getRefreshToken()
+    if (!refreshToken) {
+      return Promise.reject(new Error('no refresh token'))
+    }
+    refreshing = axios
+      .post('/api/auth/refresh', { refresh_token: refreshToken })
+      .then((response) => {
+        const { token, refresh_token } = response.data
+        setToken(token)
+        setRefreshToken(refresh_token)
+        return token as string
+      })
+      .finally(() => {
+        refreshing = null
+      })
+  }
+  return refreshing
+}
+
+// 响应拦截器 - 处理401（先尝试刷新令牌，失败再跳转登录）
 api.interceptors.response.use(
   (response) => response,
-  (error) => {
-    if (error.response?.status === 401) {
+  async (error) => {
+    const original = error.config
+    if (error.response?.status === 401 && original && !original._retry && getRefreshToken()) {
+      original._retry = true
+      try {
+        const token = await refreshAccessToken()
+        original.headers.Authorization = `Bearer ${token}`
+        return api(original)
+      } catch {
+        // 刷新失败，走下面的登出流程
+      }
+    }
+    // 服务端要求先修改密码（例如管理员刚重置了密码）
+    if (error.response?.status === 403 && error.response.data?.code === 'password_change_required') {
+      const user = localStorage.getItem('user')
+      if (user) {
+        localStorage.setItem('user', JSON.stringify({ ...JSON.parse(user), must_change_password: true }))
+      }
+      window.location.href = '/change-password'
+      return Promise.reject(error)
+    }
+    // 登录接口的 401 是用户名密码或验证码错误，交给登录页自己显示
+    if (error.response?.status === 401 && !original?.url?.startsWith('/auth/login')) {
       localStorage.removeItem('token')
+      localStorage.removeItem('refresh_token')
       localStorage.removeItem('user')
       window.location.href = '/login'
     }
@@ -2,6 +2,8 @@ export interface User {
   id: number
   username: string
   is_admin: boolean
+  role?: string
+  must_change_password?: boolean
   created_at: string
   updated_at: string
 }
@@ -16,6 +18,25 @@ export const setToken = (token: string): void => {
 
 export const removeToken = (): void => {
   localStorage.removeItem('token')
+  localStorage.removeItem('refresh_token')
+}
+
+export const getRefreshToken = (): string | null => {
+  return localStorage.getItem('refresh_token')
+}
+
+export const setRefreshToken = (token: string): void => {
+  localStorage.setItem('refresh_token', token)
+}
+
+// 访问令牌是否已过期（提前 10 秒视为过期）
+export const isTokenExpired = (token: string): boolean => {
+  try {
+    const payload = JSON.parse(atob(token.split('.')[1].replace(/-/g, '+').replace(/_/g, '/')))
+    return !payload.exp || payload.exp * 1000 < Date.now() + 10000
+  } catch {
+    return true
+  }
 }
 
 export const getUser = (): User | null => {
@@ -45,7 +66,24 @@ export const isAdmin = (): boolean => {
   return user?.is_admin || false
 }
 
-export const logout = (): void => {
+// 是否需要先修改密码（首次登录或管理员重置密码后）
+export const mustChangePassword = (): boolean => {
+  return getUser()?.must_change_password || false
+}
+
+export const logout = async (): Promise<void> => {
+  // 通知服务端撤销当前会话（失败也继续登出）
+  const token = getToken()
+  if (token) {
+    try {
+      await fetch('/api/auth/logout', {
+        method: 'POST',
+        headers: { Authorization: `Bearer ${token}` },
+      })
+    } catch {
+      // 忽略
+    }
+  }
   removeToken()
   removeUser()
   window.location.href = '/login'